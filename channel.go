@@ -0,0 +1,63 @@
+package gomq
+
+import (
+	"errors"
+	"net"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// ChannelSocket is a ZMQ_CHANNEL socket type. It is
+// a goroutine safe PairSocket, that only supports
+// single frame messages.
+// See: https://rfc.zeromq.org/spec:51
+type ChannelSocket struct {
+	*PairSocket
+}
+
+// NewChannel accepts a zmtp.SecurityMechanism and returns
+// a ChannelSocket.
+func NewChannel(mechanism zmtp.SecurityMechanism) *ChannelSocket {
+	return &ChannelSocket{
+		PairSocket: newPairSocket(zmtp.ChannelSocketType, mechanism),
+	}
+}
+
+// Bind accepts a zeromq endpoint and binds the
+// channel socket to it. The endpoint string should be in
+// the format "<proto>://<address>", e.g.
+// "tcp://<address>:<port>" or "ipc://<path>".
+func (c *ChannelSocket) Bind(endpoint string) (net.Addr, error) {
+	return BindServer(c, endpoint)
+}
+
+// Connect accepts a zeromq endpoint and connects the
+// channel socket to it. The endpoint string should be in
+// the format "<proto>://<address>", e.g.
+// "tcp://<address>:<port>" or "ipc://<path>".
+func (c *ChannelSocket) Connect(endpoint string) error {
+	return ConnectClient(c, endpoint)
+}
+
+// Send sends a message to the peer.
+func (c *ChannelSocket) Send(b []byte) error {
+	conn, err := c.nextConnection()
+	if err != nil {
+		return err
+	}
+	return conn.zmtp.SendFrame(b)
+}
+
+// SendMultipart sends a single frame message. Channel
+// sockets do not support multipart messages.
+func (c *ChannelSocket) SendMultipart(b [][]byte) error {
+	if len(b) != 1 {
+		return errors.New("gomq: channel sockets do not support multipart messages")
+	}
+	return c.Send(b[0])
+}
+
+var (
+	_ Client = (*ChannelSocket)(nil)
+	_ Server = (*ChannelSocket)(nil)
+)
@@ -17,9 +17,9 @@ func NewClient(mechanism zmtp.SecurityMechanism) Client {
 }
 
 // Connect accepts a zeromq endpoint and connects the
-// client socket to it. Currently the only transport
-// supported is TCP. The endpoint string should be
-// in the format "tcp://<address>:<port>".
+// client socket to it. The endpoint string should be in
+// the format "<proto>://<address>", e.g.
+// "tcp://<address>:<port>" or "ipc://<path>".
 func (c *ClientSocket) Connect(endpoint string) error {
 	return ConnectClient(c, endpoint)
 }
@@ -17,9 +17,9 @@ func NewDealer(mechanism zmtp.SecurityMechanism, id string) Dealer {
 }
 
 // Connect accepts a zeromq endpoint and connects the
-// dealer socket to it. Currently the only transport
-// supported is TCP. The endpoint string should be
-// in the format "tcp://<address>:<port>".
+// dealer socket to it. The endpoint string should be in
+// the format "<proto>://<address>", e.g.
+// "tcp://<address>:<port>" or "ipc://<path>".
 func (d *DealerSocket) Connect(endpoint string) error {
 	return ConnectDealer(d, endpoint)
 }
@@ -0,0 +1,190 @@
+package gomq
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// DishSocket is a ZMQ_DISH socket type.
+// See: https://rfc.zeromq.org/spec:48
+type DishSocket struct {
+	*Socket
+
+	groupsLock *sync.Mutex
+	groups     map[string]struct{}
+
+	udpLock  *sync.Mutex
+	udpConns []*net.UDPConn
+}
+
+// NewDish accepts a zmtp.SecurityMechanism and returns
+// a DishSocket.
+func NewDish(mechanism zmtp.SecurityMechanism) *DishSocket {
+	return &DishSocket{
+		Socket:     NewSocket(false, zmtp.DishSocketType, nil, mechanism),
+		groupsLock: &sync.Mutex{},
+		groups:     make(map[string]struct{}),
+		udpLock:    &sync.Mutex{},
+	}
+}
+
+// Bind accepts a zeromq endpoint and binds the
+// dish socket to it. The endpoint string should be in
+// the format "<proto>://<address>", e.g.
+// "tcp://<address>:<port>" or "ipc://<path>". Over
+// "udp://<address>:<port>", where the address may be "*"
+// or a multicast group, messages are received as datagrams.
+func (d *DishSocket) Bind(endpoint string) (net.Addr, error) {
+	if strings.HasPrefix(endpoint, "udp://") {
+		conn, err := listenUDP(strings.TrimPrefix(endpoint, "udp://"))
+		if err != nil {
+			return nil, err
+		}
+		d.udpLock.Lock()
+		d.udpConns = append(d.udpConns, conn)
+		d.udpLock.Unlock()
+
+		go serveUDP(d, conn)
+		return conn.LocalAddr(), nil
+	}
+	return BindServer(d, endpoint)
+}
+
+// Connect accepts a zeromq endpoint and connects the
+// dish socket to it. The endpoint string should be in
+// the format "<proto>://<address>", e.g.
+// "tcp://<address>:<port>" or "ipc://<path>". Dish sockets
+// cannot connect to udp endpoints.
+func (d *DishSocket) Connect(endpoint string) error {
+	if strings.HasPrefix(endpoint, "udp://") {
+		return errors.New("gomq: dish sockets cannot connect to udp endpoints")
+	}
+	return ConnectClient(d, endpoint)
+}
+
+// Close closes all the connections of the socket,
+// udp ones included.
+func (d *DishSocket) Close() {
+	d.udpLock.Lock()
+	for _, conn := range d.udpConns {
+		conn.Close()
+	}
+	d.udpConns = nil
+	d.udpLock.Unlock()
+	d.Socket.Close()
+}
+
+// AddConnection adds a gomq.Connection to the socket
+// and sends it the currently joined groups.
+func (d *DishSocket) AddConnection(conn *Connection) {
+	d.groupsLock.Lock()
+	defer d.groupsLock.Unlock()
+
+	d.Socket.AddConnection(conn)
+	for group := range d.groups {
+		conn.zmtp.SendCommand("JOIN", []byte(group))
+	}
+}
+
+// Join joins group, so that messages sent to it
+// are received by the dish.
+func (d *DishSocket) Join(group string) error {
+	if err := checkGroup(group); err != nil {
+		return err
+	}
+
+	d.groupsLock.Lock()
+	defer d.groupsLock.Unlock()
+
+	if _, ok := d.groups[group]; ok {
+		return fmt.Errorf("gomq: group %q already joined", group)
+	}
+	d.groups[group] = struct{}{}
+	return d.sendCommand("JOIN", []byte(group))
+}
+
+// Leave leaves a group previously joined with Join.
+func (d *DishSocket) Leave(group string) error {
+	d.groupsLock.Lock()
+	defer d.groupsLock.Unlock()
+
+	if _, ok := d.groups[group]; !ok {
+		return fmt.Errorf("gomq: group %q not joined", group)
+	}
+	delete(d.groups, group)
+	return d.sendCommand("LEAVE", []byte(group))
+}
+
+// sendCommand sends a command to all the peers.
+func (d *DishSocket) sendCommand(name string, body []byte) error {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	for _, conn := range d.conns {
+		if err := conn.zmtp.SendCommand(name, body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Send is not supported by dish sockets.
+func (d *DishSocket) Send(b []byte) error {
+	return errors.New("gomq: dish sockets cannot send messages")
+}
+
+// SendMultipart is not supported by dish sockets.
+func (d *DishSocket) SendMultipart(b [][]byte) error {
+	return errors.New("gomq: dish sockets cannot send messages")
+}
+
+// Recv receives the body of a message sent to
+// one of the joined groups.
+func (d *DishSocket) Recv() ([]byte, error) {
+	msg, err := d.RecvMessage()
+	if err != nil {
+		return nil, err
+	}
+	return msg.Body[0], nil
+}
+
+// RecvMultipart receives the body of a message sent
+// to one of the joined groups, as a single frame.
+func (d *DishSocket) RecvMultipart() ([][]byte, error) {
+	msg, err := d.RecvMessage()
+	if err != nil {
+		return nil, err
+	}
+	return msg.Body, nil
+}
+
+// RecvMessage receives a message sent to one of the
+// joined groups. The group is set on the message.
+func (d *DishSocket) RecvMessage() (*zmtp.Message, error) {
+	for {
+		msg := <-d.recvChannel
+		if msg.Err != nil {
+			return nil, msg.Err
+		}
+		if msg.MessageType != zmtp.UserMessage || len(msg.Body) != 1 {
+			continue
+		}
+
+		d.groupsLock.Lock()
+		_, ok := d.groups[msg.Group]
+		d.groupsLock.Unlock()
+		if ok {
+			return msg, nil
+		}
+	}
+}
+
+var (
+	_ Client = (*DishSocket)(nil)
+	_ Server = (*DishSocket)(nil)
+)
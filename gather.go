@@ -0,0 +1,76 @@
+package gomq
+
+import (
+	"errors"
+	"net"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// GatherSocket is a ZMQ_GATHER socket type.
+// It is goroutine safe.
+type GatherSocket struct {
+	*Socket
+}
+
+// NewGather accepts a zmtp.SecurityMechanism and returns
+// a GatherSocket.
+func NewGather(mechanism zmtp.SecurityMechanism) *GatherSocket {
+	return &GatherSocket{
+		Socket: NewSocket(true, zmtp.GatherSocketType, nil, mechanism),
+	}
+}
+
+// Bind accepts a zeromq endpoint and binds the
+// gather socket to it. The endpoint string should be in
+// the format "<proto>://<address>", e.g.
+// "tcp://<address>:<port>" or "ipc://<path>".
+func (g *GatherSocket) Bind(endpoint string) (net.Addr, error) {
+	return BindServer(g, endpoint)
+}
+
+// Connect accepts a zeromq endpoint and connects the
+// gather socket to it. The endpoint string should be in
+// the format "<proto>://<address>", e.g.
+// "tcp://<address>:<port>" or "ipc://<path>".
+func (g *GatherSocket) Connect(endpoint string) error {
+	return ConnectClient(g, endpoint)
+}
+
+// Send is not supported by gather sockets.
+func (g *GatherSocket) Send(b []byte) error {
+	return errors.New("gomq: gather sockets cannot send messages")
+}
+
+// SendMultipart is not supported by gather sockets.
+func (g *GatherSocket) SendMultipart(b [][]byte) error {
+	return errors.New("gomq: gather sockets cannot send messages")
+}
+
+// Recv receives a message from any peer.
+func (g *GatherSocket) Recv() ([]byte, error) {
+	for {
+		msg := <-g.recvChannel
+		if msg.Err != nil {
+			return nil, msg.Err
+		}
+		if msg.MessageType == zmtp.UserMessage {
+			return msg.Body[0], nil
+		}
+	}
+}
+
+// RecvMultipart receives a message from any peer,
+// as a single frame.
+func (g *GatherSocket) RecvMultipart() ([][]byte, error) {
+	msg, err := g.Recv()
+	if err != nil {
+		return nil, err
+	}
+	return [][]byte{msg}, nil
+}
+
+var (
+	_ Client = (*GatherSocket)(nil)
+	_ Server = (*GatherSocket)(nil)
+)
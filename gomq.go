@@ -1,6 +1,8 @@
 package gomq
 
 import (
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -24,8 +26,10 @@ var (
 // both the net.Conn transport as well as the
 // zmtp connection information.
 type Connection struct {
-	net  net.Conn
-	zmtp *zmtp.Connection
+	id       string
+	net      net.Conn
+	zmtp     *zmtp.Connection
+	endpoint string // the endpoint connected to, if any
 }
 
 // NewConnection accepts a net.Conn, a *zmtp.Connection
@@ -43,6 +47,12 @@ func (c *Connection) Send(b []byte) error {
 	return c.zmtp.SendFrame(b)
 }
 
+// Metadata returns the value of a metadata property
+// of the connection, e.g. "Identity".
+func (c *Connection) Metadata(name string) (string, bool) {
+	return c.zmtp.Metadata(name)
+}
+
 // SendMultipart ...
 func (c *Connection) SendMultipart(b [][]byte) error {
 	d := make([][]byte, len(b)+1) // FIXME(sbinet): allocates
@@ -78,36 +88,82 @@ type Client interface {
 }
 
 // ConnectClient accepts a Client interface and an endpoint
-// in the format <proto>://<address>:<port>. It then attempts
-// to connect to the endpoint and perform a ZMTP handshake.
+// in the format <scheme>://<address>, e.g. tcp://<address>:<port>,
+// ipc://<path> or inproc://<name>. It then attempts to connect
+// to the endpoint, using the transport registered for the scheme,
+// and perform a ZMTP handshake.
 func ConnectClient(c Client, endpoint string) error {
-	parts := strings.Split(endpoint, "://")
+	_, err := connectClient(c, endpoint)
+	return err
+}
 
-	if parts[0] != "tcp" {
-		return ErrBadProto(parts[0])
+// connectClient connects c to the endpoint and returns
+// the new connection.
+func connectClient(c Client, endpoint string) (*Connection, error) {
+	scheme, address, err := parseEndpoint(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if scheme != "inproc" {
+		if _, err := socketTransport(c, scheme); err != nil {
+			return nil, err
+		}
 	}
 
 Connect:
-	netConn, err := net.Dial(parts[0], parts[1])
+	if socketClosed(c) {
+		return nil, errors.New("gomq: socket closed")
+	}
+	netConn, zmtpConn, err := dial(c, scheme, address)
 	if err != nil {
 		time.Sleep(c.RetryInterval())
 		goto Connect
 	}
 
-	zmtpConn := zmtp.NewConnection(netConn)
+	allowZMTP20(c, zmtpConn)
+	setHeartbeat(c, zmtpConn)
 	_, err = zmtpConn.Prepare(c.SecurityMechanism(), c.SocketType(), c.SocketIdentity(), false, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	conn := &Connection{
-		net:  netConn,
-		zmtp: zmtpConn,
+		net:      netConn,
+		zmtp:     zmtpConn,
+		endpoint: endpoint,
+	}
+
+	if f, ok := c.(connectionFilter); ok && !f.acceptConnection(conn) {
+		zmtpConn.Close()
+		return nil, errors.New("gomq: connection refused by the socket")
+	}
+
+	if socketClosed(c) {
+		zmtpConn.Close()
+		return nil, errors.New("gomq: socket closed")
 	}
 
 	c.AddConnection(conn)
-	zmtpConn.Recv(c.RecvChannel())
-	return nil
+	go serveConnection(c, conn)
+	return conn, nil
+}
+
+// reconnect connects c to the endpoint again, once its
+// connection to a dead peer was closed, until it succeeds
+// or c is closed.
+func reconnect(c Client, endpoint string) {
+	for !socketClosed(c) {
+		if _, err := connectClient(c, endpoint); err == nil {
+			return
+		}
+		time.Sleep(c.RetryInterval())
+	}
+}
+
+// socketClosed reports whether the socket s was closed.
+func socketClosed(s ZeroMQSocket) bool {
+	c, ok := s.(interface{ closed() bool })
+	return ok && c.closed()
 }
 
 // Server is a gomq interface used for server sockets.
@@ -119,13 +175,26 @@ type Server interface {
 }
 
 // BindServer accepts a Server interface and an endpoint
-// in the format <proto>://<address>:<port>. It then attempts
-// to bind to the endpoint.
+// in the format <scheme>://<address>, e.g. tcp://<address>:<port>,
+// ipc://<path> or inproc://<name>. It then attempts to bind to
+// the endpoint, using the transport registered for the scheme.
 func BindServer(s Server, endpoint string) (net.Addr, error) {
 	var addr net.Addr
-	parts := strings.Split(endpoint, "://")
+	scheme, address, err := parseEndpoint(endpoint)
+	if err != nil {
+		return addr, err
+	}
+
+	if scheme == "inproc" {
+		return bindInproc(s, address)
+	}
+
+	t, err := socketTransport(s, scheme)
+	if err != nil {
+		return addr, err
+	}
 
-	ln, err := net.Listen(parts[0], parts[1])
+	ln, err := t.Listen(address)
 	if err != nil {
 		return addr, err
 	}
@@ -137,34 +206,9 @@ func BindServer(s Server, endpoint string) (net.Addr, error) {
 				continue
 			}
 
-			go func() {
-				zmtpConn := zmtp.NewConnection(netConn)
-				_, err = zmtpConn.Prepare(s.SecurityMechanism(), s.SocketType(), s.SocketIdentity(), true, nil)
-
-				if err != nil {
-					return
-				}
-
-				// replace conn, if identity already exist.
-				identity, _ := zmtpConn.GetIdentity()
-				s.RemoveConnection(identity)
-				s.AddConnection(NewConnection(netConn, zmtpConn))
-
-				// remove conn, if the connection has lost.
-				zmtpMsgs := make(chan *zmtp.Message, 3)
-				zmtpConn.Recv(zmtpMsgs)
-				for {
-					msg := <-zmtpMsgs
-
-					if msg != nil && msg.Err == io.EOF {
-						s.RemoveConnection(identity)
-						break
-					}
-
-					s.RecvChannel() <- msg
-				}
-
-			}()
+			go func(netConn net.Conn) {
+				acceptConnection(s, netConn, newZMTPConnection(s, netConn))
+			}(netConn)
 		}
 	}()
 	time.Sleep(500 * time.Millisecond)
@@ -179,31 +223,203 @@ type Dealer interface {
 	Connect(endpoint string) error
 }
 
+// acceptConnection performs the ZMTP handshake of a connection
+// accepted by s, and serves it once it was added to s.
+func acceptConnection(s Server, netConn net.Conn, zmtpConn *zmtp.Connection) {
+	if z, ok := s.(interface {
+		zap() (zmtp.ZAPHandler, string)
+	}); ok {
+		if handler, domain := z.zap(); handler != nil {
+			zmtpConn.SetZAPHandler(handler, domain, zapAddress(netConn))
+		}
+	}
+
+	allowZMTP20(s, zmtpConn)
+	setHeartbeat(s, zmtpConn)
+	_, err := zmtpConn.Prepare(s.SecurityMechanism(), s.SocketType(), s.SocketIdentity(), true, nil)
+	if err != nil {
+		zmtpConn.Close()
+		return
+	}
+
+	conn := NewConnection(netConn, zmtpConn)
+	if f, ok := s.(connectionFilter); ok && !f.acceptConnection(conn) {
+		zmtpConn.Close()
+		return
+	}
+
+	// replace conn, if identity already exist, unless
+	// the socket generates the routing ids itself.
+	if g, ok := s.(interface{ generatesRoutingIDs() bool }); !ok || !g.generatesRoutingIDs() {
+		identity, _ := zmtpConn.GetIdentity()
+		s.RemoveConnection(identity)
+	}
+
+	s.AddConnection(conn)
+	serveConnection(s, conn)
+}
+
 // ConnectDealer accepts a Dealer interface and an endpoint
-// in the format <proto>://<address>:<port>. It then attempts
-// to connect to the endpoint and perform a ZMTP handshake.
+// in the format <scheme>://<address>. It then attempts to
+// connect to the endpoint, as ConnectClient does.
 func ConnectDealer(d Dealer, endpoint string) error {
-	parts := strings.Split(endpoint, "://")
+	_, err := connectClient(d, endpoint)
+	return err
+}
 
-Connect:
-	netConn, err := net.Dial(parts[0], parts[1])
+// parseEndpoint splits a zeromq endpoint, in the
+// format <scheme>://<address>, into its parts.
+func parseEndpoint(endpoint string) (scheme, address string, err error) {
+	parts := strings.SplitN(endpoint, "://", 2)
+	if len(parts) != 2 {
+		return "", "", ErrBadProto(parts[0])
+	}
+	return parts[0], parts[1], nil
+}
+
+// dial connects c to the address of a zeromq endpoint
+// using the transport registered for its scheme.
+func dial(c Client, scheme, address string) (net.Conn, *zmtp.Connection, error) {
+	if scheme == "inproc" {
+		zmtpConn, err := dialInproc(address)
+		return nil, zmtpConn, err
+	}
+
+	t, err := socketTransport(c, scheme)
 	if err != nil {
-		time.Sleep(d.RetryInterval())
-		goto Connect
+		return nil, nil, err
 	}
 
-	zmtpConn := zmtp.NewConnection(netConn)
-	_, err = zmtpConn.Prepare(d.SecurityMechanism(), d.SocketType(), d.SocketIdentity(), false, nil)
+	netConn, err := t.Dial(address)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
+	return netConn, newZMTPConnection(c, netConn), nil
+}
 
-	conn := &Connection{
-		net:  netConn,
-		zmtp: zmtpConn,
+// allowZMTP20 lets zmtpConn talk to ZMTP 2.0 peers
+// if the socket s allows it.
+func allowZMTP20(s ZeroMQSocket, zmtpConn *zmtp.Connection) {
+	if z, ok := s.(interface{ ZMTP20Allowed() bool }); ok {
+		zmtpConn.SetZMTP20Allowed(z.ZMTP20Allowed())
+	}
+}
+
+// setHeartbeat sets the heartbeat of zmtpConn from the
+// options of the socket s, if it sends PINGs.
+func setHeartbeat(s ZeroMQSocket, zmtpConn *zmtp.Connection) {
+	if h, ok := s.(interface {
+		heartbeat() (ivl, timeout, ttl time.Duration)
+	}); ok {
+		if ivl, timeout, ttl := h.heartbeat(); ivl > 0 {
+			zmtpConn.SetHeartbeat(ivl, timeout, ttl)
+		}
+	}
+}
+
+// newZMTPConnection returns a zmtp.Connection of the socket s over
+// netConn, holding the metadata of the underlying transport.
+// Transports with message framing, such as WebSocket, carry one
+// ZMTP frame per message.
+func newZMTPConnection(s ZeroMQSocket, netConn net.Conn) *zmtp.Connection {
+	if ws, ok := netConn.(*wsConn); ok {
+		ws.mechanism = s.SecurityMechanism().Type()
 	}
 
-	d.AddConnection(conn)
-	zmtpConn.RecvMultipart(d.RecvChannel())
-	return nil
+	var zmtpConn *zmtp.Connection
+	if mrw, ok := netConn.(zmtp.MessageReadWriter); ok {
+		zmtpConn = zmtp.NewMessageConnection(mrw)
+	} else {
+		zmtpConn = zmtp.NewConnection(netConn)
+	}
+	var metadata map[string]string
+	switch conn := netConn.(type) {
+	case *net.UnixConn:
+		metadata = peerCredentials(conn)
+	case *tls.Conn:
+		metadata = tlsMetadata(conn)
+	}
+	for k, v := range metadata {
+		zmtpConn.SetMetadata(k, v)
+	}
+	return zmtpConn
+}
+
+// serveConnection forwards the messages received on conn to the
+// socket's receive channel, tagging each of them with the routing
+// id of the peer. The connection is removed from the socket once
+// it has been lost. Connections closed by the heartbeat are
+// connected again if the socket connected them.
+func serveConnection(s ZeroMQSocket, conn *Connection) {
+	zmtpMsgs := make(chan *zmtp.Message, 3)
+	if isSingleFrame(s.SocketType()) {
+		conn.zmtp.Recv(zmtpMsgs)
+	} else {
+		conn.zmtp.RecvMultipart(zmtpMsgs)
+	}
+
+	for {
+		msg := <-zmtpMsgs
+		msg.RoutingID = conn.id
+
+		if msg.Err != nil {
+			removeConnection(s, conn)
+			if msg.Err == zmtp.ErrHeartbeatTimeout {
+				if c, ok := s.(Client); ok && conn.endpoint != "" {
+					go reconnect(c, conn.endpoint)
+				}
+				return
+			}
+			if msg.Err != io.EOF {
+				s.RecvChannel() <- msg
+			}
+			return
+		}
+
+		if h, ok := s.(commandHandler); ok && msg.Name != "" {
+			h.handleCommand(conn, msg.Name, msg.Body[0])
+			continue
+		}
+
+		s.RecvChannel() <- msg
+	}
+}
+
+// connectionFilter is implemented by sockets that may
+// refuse a peer once the ZMTP handshake is done.
+type connectionFilter interface {
+	acceptConnection(conn *Connection) bool
+}
+
+// commandHandler is implemented by sockets handling the
+// ZMTP commands sent by their peers, e.g. SUBSCRIBE, instead
+// of passing them on to the application.
+type commandHandler interface {
+	handleCommand(conn *Connection, name string, body []byte)
+}
+
+// removeConnection removes conn from the socket, unless it has
+// already been replaced by a newer connection with the same
+// routing id.
+func removeConnection(s ZeroMQSocket, conn *Connection) {
+	if g, ok := s.(interface {
+		GetConnection(string) (*Connection, error)
+	}); ok {
+		if cur, err := g.GetConnection(conn.id); err != nil || cur != conn {
+			return
+		}
+	}
+	s.RemoveConnection(conn.id)
+}
+
+// isSingleFrame reports whether sockets of the given type only
+// exchange single frame messages.
+func isSingleFrame(t zmtp.SocketType) bool {
+	switch t {
+	case zmtp.ClientSocketType, zmtp.ServerSocketType,
+		zmtp.ScatterSocketType, zmtp.GatherSocketType,
+		zmtp.PeerSocketType, zmtp.ChannelSocketType:
+		return true
+	}
+	return false
 }
@@ -0,0 +1,66 @@
+package gomq
+
+import (
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// inprocEndpoints is the process-wide registry of the
+// servers bound to inproc endpoints, by name.
+var inprocEndpoints = struct {
+	sync.Mutex
+	servers map[string]Server
+}{
+	servers: make(map[string]Server),
+}
+
+// inprocAddr is the net.Addr of an inproc endpoint.
+type inprocAddr string
+
+func (a inprocAddr) Network() string { return "inproc" }
+func (a inprocAddr) String() string  { return string(a) }
+
+// bindInproc binds s to the inproc endpoint name.
+func bindInproc(s Server, name string) (net.Addr, error) {
+	inprocEndpoints.Lock()
+	defer inprocEndpoints.Unlock()
+
+	if _, ok := inprocEndpoints.servers[name]; ok {
+		return nil, fmt.Errorf("gomq: inproc endpoint %q already bound", name)
+	}
+	inprocEndpoints.servers[name] = s
+	return inprocAddr(name), nil
+}
+
+// unbindInproc removes the inproc endpoints bound by the
+// socket s, once it is closed.
+func unbindInproc(s *Socket) {
+	inprocEndpoints.Lock()
+	defer inprocEndpoints.Unlock()
+
+	for name, server := range inprocEndpoints.servers {
+		if b, ok := server.(interface{ base() *Socket }); ok && b.base() == s {
+			delete(inprocEndpoints.servers, name)
+		}
+	}
+}
+
+// dialInproc connects to the server bound to the inproc endpoint
+// name, through a zmtp pipe. The other end of the pipe is accepted
+// by the server as any other connection.
+func dialInproc(name string) (*zmtp.Connection, error) {
+	inprocEndpoints.Lock()
+	s, ok := inprocEndpoints.servers[name]
+	inprocEndpoints.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("gomq: inproc endpoint %q not bound", name)
+	}
+
+	conn, serverConn := zmtp.NewPipe()
+	go acceptConnection(s, nil, serverConn)
+	return conn, nil
+}
@@ -0,0 +1,35 @@
+package gomq
+
+import (
+	"net"
+	"os"
+	"strings"
+)
+
+// ipcTransport is the transport for ipc:// endpoints,
+// over unix domain sockets.
+type ipcTransport struct{}
+
+func (ipcTransport) Dial(path string) (net.Conn, error) {
+	return net.Dial("unix", path)
+}
+
+func (ipcTransport) Listen(path string) (net.Listener, error) {
+	return listenIPC(path)
+}
+
+// listenIPC listens on the unix domain socket at path.
+// A stale socket file, left over by a process that is
+// gone, is removed first.
+func listenIPC(path string) (net.Listener, error) {
+	if !strings.HasPrefix(path, "@") { // not in the abstract namespace
+		if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			if conn, err := net.Dial("unix", path); err == nil {
+				conn.Close()
+			} else {
+				os.Remove(path)
+			}
+		}
+	}
+	return net.Listen("unix", path)
+}
@@ -0,0 +1,30 @@
+package gomq
+
+import (
+	"net"
+	"strconv"
+	"syscall"
+)
+
+// peerCredentials returns the credentials of the process
+// at the other end of conn as connection metadata.
+func peerCredentials(conn *net.UnixConn) map[string]string {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return nil
+	}
+
+	var cred *syscall.Ucred
+	err = raw.Control(func(fd uintptr) {
+		cred, err = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if err != nil || cred == nil {
+		return nil
+	}
+
+	return map[string]string{
+		"Peer-Uid": strconv.FormatUint(uint64(cred.Uid), 10),
+		"Peer-Gid": strconv.FormatUint(uint64(cred.Gid), 10),
+		"Peer-Pid": strconv.FormatInt(int64(cred.Pid), 10),
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package gomq
+
+import "net"
+
+// peerCredentials returns the credentials of the process
+// at the other end of conn as connection metadata. They
+// are only available on linux.
+func peerCredentials(conn *net.UnixConn) map[string]string {
+	return nil
+}
@@ -0,0 +1,124 @@
+package gomq
+
+import (
+	"net"
+	"sync"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// PairSocket is a ZMQ_PAIR socket type. It is
+// connected to at most one peer at a time, further
+// peers are refused.
+// See: https://rfc.zeromq.org/spec:31
+type PairSocket struct {
+	*Socket
+
+	peerLock *sync.Mutex
+	hasPeer  bool
+}
+
+// NewPair accepts a zmtp.SecurityMechanism and returns
+// a PairSocket.
+func NewPair(mechanism zmtp.SecurityMechanism) *PairSocket {
+	return newPairSocket(zmtp.PairSocketType, mechanism)
+}
+
+func newPairSocket(sockType zmtp.SocketType, mechanism zmtp.SecurityMechanism) *PairSocket {
+	return &PairSocket{
+		Socket:   NewSocket(false, sockType, nil, mechanism),
+		peerLock: &sync.Mutex{},
+	}
+}
+
+// Bind accepts a zeromq endpoint and binds the
+// pair socket to it. The endpoint string should be in
+// the format "<proto>://<address>", e.g.
+// "tcp://<address>:<port>" or "ipc://<path>".
+func (p *PairSocket) Bind(endpoint string) (net.Addr, error) {
+	return BindServer(p, endpoint)
+}
+
+// Connect accepts a zeromq endpoint and connects the
+// pair socket to it. The endpoint string should be in
+// the format "<proto>://<address>", e.g.
+// "tcp://<address>:<port>" or "ipc://<path>".
+func (p *PairSocket) Connect(endpoint string) error {
+	return ConnectClient(p, endpoint)
+}
+
+// acceptConnection accepts conn only if the socket
+// is not connected to a peer yet. The peer is only
+// taken once conn is added to the socket.
+func (p *PairSocket) acceptConnection(conn *Connection) bool {
+	p.peerLock.Lock()
+	defer p.peerLock.Unlock()
+	return !p.hasPeer
+}
+
+// AddConnection adds conn as the peer of the socket. It
+// is closed if another peer was added since it was accepted.
+func (p *PairSocket) AddConnection(conn *Connection) {
+	p.peerLock.Lock()
+	defer p.peerLock.Unlock()
+	if p.hasPeer {
+		conn.zmtp.Close()
+		return
+	}
+	p.Socket.AddConnection(conn)
+	p.hasPeer = true
+}
+
+// RemoveConnection removes the peer with the given
+// routing id, so that a new peer can be accepted.
+func (p *PairSocket) RemoveConnection(uuid string) {
+	p.peerLock.Lock()
+	defer p.peerLock.Unlock()
+	if _, err := p.GetConnection(uuid); err != nil {
+		return
+	}
+	p.Socket.RemoveConnection(uuid)
+	p.hasPeer = false
+}
+
+// Send sends a single frame message to the peer.
+func (p *PairSocket) Send(b []byte) error {
+	return p.SendMultipart([][]byte{b})
+}
+
+// SendMultipart sends a message to the peer.
+func (p *PairSocket) SendMultipart(b [][]byte) error {
+	conn, err := p.nextConnection()
+	if err != nil {
+		return err
+	}
+	return conn.zmtp.SendMultipart(b)
+}
+
+// Recv receives a message from the peer and
+// returns its first frame.
+func (p *PairSocket) Recv() ([]byte, error) {
+	msg, err := p.RecvMultipart()
+	if err != nil {
+		return nil, err
+	}
+	return msg[0], nil
+}
+
+// RecvMultipart receives a message from the peer.
+func (p *PairSocket) RecvMultipart() ([][]byte, error) {
+	for {
+		msg := <-p.recvChannel
+		if msg.Err != nil {
+			return nil, msg.Err
+		}
+		if msg.MessageType == zmtp.UserMessage {
+			return msg.Body, nil
+		}
+	}
+}
+
+var (
+	_ Client = (*PairSocket)(nil)
+	_ Server = (*PairSocket)(nil)
+)
@@ -0,0 +1,121 @@
+package gomq
+
+import (
+	"errors"
+	"net"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// PeerSocket is a ZMQ_PEER socket type. Messages are
+// sent to and received from a peer identified by its
+// routing id. It is goroutine safe.
+// See: https://rfc.zeromq.org/spec:51
+type PeerSocket struct {
+	*Socket
+}
+
+// NewPeer accepts a zmtp.SecurityMechanism and returns
+// a PeerSocket.
+func NewPeer(mechanism zmtp.SecurityMechanism) *PeerSocket {
+	return &PeerSocket{
+		Socket: NewSocket(false, zmtp.PeerSocketType, nil, mechanism),
+	}
+}
+
+// Bind accepts a zeromq endpoint and binds the
+// peer socket to it. The endpoint string should be in
+// the format "<proto>://<address>", e.g.
+// "tcp://<address>:<port>" or "ipc://<path>".
+func (p *PeerSocket) Bind(endpoint string) (net.Addr, error) {
+	return BindServer(p, endpoint)
+}
+
+// Connect accepts a zeromq endpoint and connects the
+// peer socket to it. The endpoint string should be in
+// the format "<proto>://<address>", e.g.
+// "tcp://<address>:<port>" or "ipc://<path>".
+func (p *PeerSocket) Connect(endpoint string) error {
+	return ConnectClient(p, endpoint)
+}
+
+// ConnectPeer connects the peer socket to the endpoint,
+// like Connect, and returns the routing id of the new peer.
+func (p *PeerSocket) ConnectPeer(endpoint string) (string, error) {
+	conn, err := connectClient(p, endpoint)
+	if err != nil {
+		return "", err
+	}
+	return conn.id, nil
+}
+
+// AddConnection adds a gomq.Connection to the socket, with
+// a routing id generated by the socket, as libzmq does. The
+// identity sent by the peer, if any, is ignored.
+func (p *PeerSocket) AddConnection(conn *Connection) {
+	uuid, _ := newUUID()
+	p.addConnection(conn, uuid)
+}
+
+// generatesRoutingIDs reports that peers cannot choose
+// their routing id.
+func (p *PeerSocket) generatesRoutingIDs() bool {
+	return true
+}
+
+// Send is not supported by peer sockets, as a message
+// needs a routing id. Use SendTo.
+func (p *PeerSocket) Send(b []byte) error {
+	return errors.New("gomq: peer sockets only support SendTo")
+}
+
+// SendMultipart is not supported by peer sockets, as a
+// message needs a routing id. Use SendTo.
+func (p *PeerSocket) SendMultipart(b [][]byte) error {
+	return errors.New("gomq: peer sockets only support SendTo")
+}
+
+// SendTo sends a message to the peer with the given
+// routing id.
+func (p *PeerSocket) SendTo(routingID string, b []byte) error {
+	conn, err := p.GetConnection(routingID)
+	if err != nil {
+		return err
+	}
+	return conn.zmtp.SendFrame(b)
+}
+
+// Recv receives a message from any peer.
+func (p *PeerSocket) Recv() ([]byte, error) {
+	_, b, err := p.RecvFrom()
+	return b, err
+}
+
+// RecvMultipart receives a message from any peer,
+// as a single frame.
+func (p *PeerSocket) RecvMultipart() ([][]byte, error) {
+	b, err := p.Recv()
+	if err != nil {
+		return nil, err
+	}
+	return [][]byte{b}, nil
+}
+
+// RecvFrom receives a message from any peer and returns
+// the routing id of that peer along with the message.
+func (p *PeerSocket) RecvFrom() (string, []byte, error) {
+	for {
+		msg := <-p.recvChannel
+		if msg.Err != nil {
+			return "", nil, msg.Err
+		}
+		if msg.MessageType == zmtp.UserMessage {
+			return msg.RoutingID, msg.Body[0], nil
+		}
+	}
+}
+
+var (
+	_ Client = (*PeerSocket)(nil)
+	_ Server = (*PeerSocket)(nil)
+)
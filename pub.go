@@ -0,0 +1,165 @@
+package gomq
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// PubSocket is a ZMQ_PUB socket type.
+// See: https://rfc.zeromq.org/spec:29
+type PubSocket struct {
+	*Socket
+
+	subsLock *sync.RWMutex
+	subs     map[string]subscriptions // subscriptions by routing id
+}
+
+// NewPub accepts a zmtp.SecurityMechanism and returns
+// a PubSocket.
+func NewPub(mechanism zmtp.SecurityMechanism) *PubSocket {
+	return newPubSocket(zmtp.PubSocketType, mechanism)
+}
+
+func newPubSocket(sockType zmtp.SocketType, mechanism zmtp.SecurityMechanism) *PubSocket {
+	return &PubSocket{
+		Socket:   NewSocket(true, sockType, nil, mechanism),
+		subsLock: &sync.RWMutex{},
+		subs:     make(map[string]subscriptions),
+	}
+}
+
+// Bind accepts a zeromq endpoint and binds the
+// pub socket to it. The endpoint string should be in
+// the format "<proto>://<address>", e.g.
+// "tcp://<address>:<port>" or "ipc://<path>".
+func (p *PubSocket) Bind(endpoint string) (net.Addr, error) {
+	return BindServer(p, endpoint)
+}
+
+// Connect accepts a zeromq endpoint and connects the
+// pub socket to it. The endpoint string should be in
+// the format "<proto>://<address>", e.g.
+// "tcp://<address>:<port>" or "ipc://<path>".
+func (p *PubSocket) Connect(endpoint string) error {
+	return ConnectClient(p, endpoint)
+}
+
+// RemoveConnection removes the connection with the
+// given routing id, along with its subscriptions.
+func (p *PubSocket) RemoveConnection(uuid string) {
+	p.Socket.RemoveConnection(uuid)
+	p.subsLock.Lock()
+	delete(p.subs, uuid)
+	p.subsLock.Unlock()
+}
+
+// Recv is not supported by pub sockets.
+func (p *PubSocket) Recv() ([]byte, error) {
+	return nil, errors.New("gomq: pub sockets cannot receive messages")
+}
+
+// RecvMultipart is not supported by pub sockets.
+func (p *PubSocket) RecvMultipart() ([][]byte, error) {
+	return nil, errors.New("gomq: pub sockets cannot receive messages")
+}
+
+// Send sends a single frame message to all the
+// subscribers with a matching subscription.
+func (p *PubSocket) Send(b []byte) error {
+	return p.SendMultipart([][]byte{b})
+}
+
+// SendMultipart sends a message to all the subscribers
+// having a subscription that is a prefix of the first frame.
+// Messages without any matching subscriber are dropped. A
+// subscriber which cannot be sent the message is closed, and
+// removed once its connection is lost, instead of failing
+// the other subscribers.
+func (p *PubSocket) SendMultipart(b [][]byte) error {
+	var topic []byte
+	if len(b) > 0 {
+		topic = b[0]
+	}
+
+	// the locks are not held while writing, for a
+	// stalled subscriber not to block the whole socket
+	var conns []*Connection
+	p.lock.RLock()
+	p.subsLock.RLock()
+	for id, conn := range p.conns {
+		if p.subs[id].match(topic) {
+			conns = append(conns, conn)
+		}
+	}
+	p.subsLock.RUnlock()
+	p.lock.RUnlock()
+
+	for _, conn := range conns {
+		if err := conn.zmtp.SendMultipart(b); err != nil {
+			conn.zmtp.Close()
+		}
+	}
+	return nil
+}
+
+// handleCommand keeps track of the SUBSCRIBE and
+// CANCEL commands sent by the peers.
+func (p *PubSocket) handleCommand(conn *Connection, name string, body []byte) {
+	p.subsLock.Lock()
+	defer p.subsLock.Unlock()
+
+	switch name {
+	case "SUBSCRIBE":
+		if p.subs[conn.id] == nil {
+			p.subs[conn.id] = make(subscriptions)
+		}
+		p.subs[conn.id].add(body)
+	case "CANCEL":
+		p.subs[conn.id].remove(body)
+	}
+}
+
+// subscriptions is a set of topic prefixes, counting
+// how many times each of them was subscribed to.
+type subscriptions map[string]int
+
+// add adds prefix to the set. It reports whether
+// prefix was not already part of it.
+func (s subscriptions) add(prefix []byte) bool {
+	s[string(prefix)]++
+	return s[string(prefix)] == 1
+}
+
+// remove removes prefix from the set. It reports
+// whether prefix is no longer part of it.
+func (s subscriptions) remove(prefix []byte) bool {
+	n, ok := s[string(prefix)]
+	switch {
+	case !ok:
+		return false
+	case n > 1:
+		s[string(prefix)]--
+		return false
+	default:
+		delete(s, string(prefix))
+		return true
+	}
+}
+
+func (s subscriptions) match(topic []byte) bool {
+	for prefix := range s {
+		if bytes.HasPrefix(topic, []byte(prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	_ Client = (*PubSocket)(nil)
+	_ Server = (*PubSocket)(nil)
+)
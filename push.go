@@ -21,17 +21,17 @@ func NewPush(mechanism zmtp.SecurityMechanism) *PushSocket {
 }
 
 // Bind accepts a zeromq endpoint and binds the
-// push socket to it. Currently the only transport
-// supported is TCP. The endpoint string should be
-// in the format "tcp://<address>:<port>".
+// push socket to it. The endpoint string should be in
+// the format "<proto>://<address>", e.g.
+// "tcp://<address>:<port>" or "ipc://<path>".
 func (s *PushSocket) Bind(endpoint string) (net.Addr, error) {
 	return BindServer(s, endpoint)
 }
 
 // Connect accepts a zeromq endpoint and connects the
-// client socket to it. Currently the only transport
-// supported is TCP. The endpoint string should be
-// in the format "tcp://<address>:<port>".
+// client socket to it. The endpoint string should be in
+// the format "<proto>://<address>", e.g.
+// "tcp://<address>:<port>" or "ipc://<path>".
 func (s *PushSocket) Connect(endpoint string) error {
 	return ConnectClient(s, endpoint)
 }
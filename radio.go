@@ -0,0 +1,189 @@
+package gomq
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// maxGroupLength is the maximum length of a RADIO/DISH group.
+const maxGroupLength = 255
+
+func checkGroup(group string) error {
+	if len(group) > maxGroupLength {
+		return fmt.Errorf("gomq: group %q is longer than %d bytes", group, maxGroupLength)
+	}
+	return nil
+}
+
+// RadioSocket is a ZMQ_RADIO socket type.
+// See: https://rfc.zeromq.org/spec:48
+type RadioSocket struct {
+	*Socket
+
+	groupsLock *sync.RWMutex
+	groups     map[string]map[string]struct{} // joined groups by routing id
+
+	udpLock  *sync.Mutex
+	udpConns []*net.UDPConn
+}
+
+// NewRadio accepts a zmtp.SecurityMechanism and returns
+// a RadioSocket.
+func NewRadio(mechanism zmtp.SecurityMechanism) *RadioSocket {
+	return &RadioSocket{
+		Socket:     NewSocket(true, zmtp.RadioSocketType, nil, mechanism),
+		groupsLock: &sync.RWMutex{},
+		groups:     make(map[string]map[string]struct{}),
+		udpLock:    &sync.Mutex{},
+	}
+}
+
+// Bind accepts a zeromq endpoint and binds the
+// radio socket to it. The endpoint string should be in
+// the format "<proto>://<address>", e.g.
+// "tcp://<address>:<port>" or "ipc://<path>". Radio sockets
+// cannot bind to udp endpoints.
+func (r *RadioSocket) Bind(endpoint string) (net.Addr, error) {
+	if strings.HasPrefix(endpoint, "udp://") {
+		return nil, errors.New("gomq: radio sockets cannot bind to udp endpoints")
+	}
+	return BindServer(r, endpoint)
+}
+
+// Connect accepts a zeromq endpoint and connects the
+// radio socket to it. The endpoint string should be in
+// the format "<proto>://<address>", e.g.
+// "tcp://<address>:<port>" or "ipc://<path>". Over
+// "udp://<address>:<port>", where the address may be
+// a multicast group, messages are sent as datagrams.
+func (r *RadioSocket) Connect(endpoint string) error {
+	if strings.HasPrefix(endpoint, "udp://") {
+		conn, err := dialUDP(strings.TrimPrefix(endpoint, "udp://"))
+		if err != nil {
+			return err
+		}
+		r.udpLock.Lock()
+		r.udpConns = append(r.udpConns, conn)
+		r.udpLock.Unlock()
+		return nil
+	}
+	return ConnectClient(r, endpoint)
+}
+
+// Close closes all the connections of the socket,
+// udp ones included.
+func (r *RadioSocket) Close() {
+	r.udpLock.Lock()
+	for _, conn := range r.udpConns {
+		conn.Close()
+	}
+	r.udpConns = nil
+	r.udpLock.Unlock()
+	r.Socket.Close()
+}
+
+// RemoveConnection removes the connection with the
+// given routing id, along with the groups it joined.
+func (r *RadioSocket) RemoveConnection(uuid string) {
+	r.Socket.RemoveConnection(uuid)
+	r.groupsLock.Lock()
+	delete(r.groups, uuid)
+	r.groupsLock.Unlock()
+}
+
+// Recv is not supported by radio sockets.
+func (r *RadioSocket) Recv() ([]byte, error) {
+	return nil, errors.New("gomq: radio sockets cannot receive messages")
+}
+
+// RecvMultipart is not supported by radio sockets.
+func (r *RadioSocket) RecvMultipart() ([][]byte, error) {
+	return nil, errors.New("gomq: radio sockets cannot receive messages")
+}
+
+// Send is not supported by radio sockets, as a message
+// needs a group. Use SendGroup.
+func (r *RadioSocket) Send(b []byte) error {
+	return errors.New("gomq: radio sockets only support SendGroup")
+}
+
+// SendMultipart is not supported by radio sockets, as
+// a message needs a group. Use SendGroup.
+func (r *RadioSocket) SendMultipart(b [][]byte) error {
+	return errors.New("gomq: radio sockets only support SendGroup")
+}
+
+// SendGroup sends body to all the peers that joined
+// group. Messages without any matching peer are dropped.
+// Over udp, where peers cannot join groups, every message
+// is sent.
+func (r *RadioSocket) SendGroup(group string, body []byte) error {
+	if err := checkGroup(group); err != nil {
+		return err
+	}
+	if err := r.sendDatagram(group, body); err != nil {
+		return err
+	}
+
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	r.groupsLock.RLock()
+	defer r.groupsLock.RUnlock()
+
+	for id, conn := range r.conns {
+		if _, ok := r.groups[id][group]; !ok {
+			continue
+		}
+		if err := conn.zmtp.SendMultipart([][]byte{[]byte(group), body}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendDatagram sends a message to the udp endpoints.
+func (r *RadioSocket) sendDatagram(group string, body []byte) error {
+	r.udpLock.Lock()
+	defer r.udpLock.Unlock()
+
+	if len(r.udpConns) == 0 {
+		return nil
+	}
+	b, err := encodeDatagram(group, body)
+	if err != nil {
+		return err
+	}
+	for _, conn := range r.udpConns {
+		if _, err := conn.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleCommand keeps track of the JOIN and
+// LEAVE commands sent by the peers.
+func (r *RadioSocket) handleCommand(conn *Connection, name string, body []byte) {
+	r.groupsLock.Lock()
+	defer r.groupsLock.Unlock()
+
+	switch name {
+	case "JOIN":
+		if r.groups[conn.id] == nil {
+			r.groups[conn.id] = make(map[string]struct{})
+		}
+		r.groups[conn.id][string(body)] = struct{}{}
+	case "LEAVE":
+		delete(r.groups[conn.id], string(body))
+	}
+}
+
+var (
+	_ Client = (*RadioSocket)(nil)
+	_ Server = (*RadioSocket)(nil)
+)
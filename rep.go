@@ -0,0 +1,126 @@
+package gomq
+
+import (
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// RepSocket is a ZMQ_REP socket type.
+// See: https://rfc.zeromq.org/spec:28
+type RepSocket struct {
+	*Socket
+
+	mu       sync.Mutex
+	pending  bool     // a request was received and not replied to yet
+	peer     string   // routing id of the peer the request came from
+	envelope [][]byte // routing frames of the request, up to the empty delimiter
+}
+
+// NewRep accepts a zmtp.SecurityMechanism and returns
+// a RepSocket.
+func NewRep(mechanism zmtp.SecurityMechanism) *RepSocket {
+	return &RepSocket{
+		Socket: NewSocket(true, zmtp.RepSocketType, nil, mechanism),
+	}
+}
+
+// Bind accepts a zeromq endpoint and binds the
+// rep socket to it. The endpoint string should be in
+// the format "<proto>://<address>", e.g.
+// "tcp://<address>:<port>" or "ipc://<path>".
+func (r *RepSocket) Bind(endpoint string) (net.Addr, error) {
+	return BindServer(r, endpoint)
+}
+
+// Connect accepts a zeromq endpoint and connects the
+// rep socket to it. The endpoint string should be in
+// the format "<proto>://<address>", e.g.
+// "tcp://<address>:<port>" or "ipc://<path>".
+func (r *RepSocket) Connect(endpoint string) error {
+	return ConnectClient(r, endpoint)
+}
+
+// Recv receives a request and returns its first frame.
+func (r *RepSocket) Recv() ([]byte, error) {
+	msg, err := r.RecvMultipart()
+	if err != nil {
+		return nil, err
+	}
+	if len(msg) == 0 {
+		return nil, nil
+	}
+	return msg[0], nil
+}
+
+// RecvMultipart receives a request, stripped from its envelope.
+// The envelope is kept until the reply is sent. It returns an
+// error if the previous request was not replied to yet.
+func (r *RepSocket) RecvMultipart() ([][]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.pending {
+		return nil, errors.New("gomq: rep socket cannot receive a request before replying to the previous one")
+	}
+
+	for {
+		msg := <-r.recvChannel
+		if msg.Err != nil {
+			return nil, msg.Err
+		}
+		if msg.MessageType != zmtp.UserMessage {
+			continue
+		}
+
+		// look for the empty delimiter, messages without
+		// one are malformed and silently dropped.
+		i := 0
+		for i < len(msg.Body) && len(msg.Body[i]) != 0 {
+			i++
+		}
+		if i == len(msg.Body) {
+			continue
+		}
+
+		r.pending = true
+		r.peer = msg.RoutingID
+		r.envelope = msg.Body[:i+1]
+		return msg.Body[i+1:], nil
+	}
+}
+
+// Send sends a single frame reply.
+func (r *RepSocket) Send(b []byte) error {
+	return r.SendMultipart([][]byte{b})
+}
+
+// SendMultipart sends a reply to the peer the last request came
+// from, prefixed with the envelope of that request. It returns an
+// error if no request is waiting for a reply.
+func (r *RepSocket) SendMultipart(b [][]byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.pending {
+		return errors.New("gomq: rep socket cannot send a reply before receiving a request")
+	}
+
+	r.pending = false
+	conn, err := r.GetConnection(r.peer)
+	if err != nil {
+		return err
+	}
+
+	d := make([][]byte, 0, len(r.envelope)+len(b))
+	d = append(d, r.envelope...)
+	d = append(d, b...)
+	return conn.zmtp.SendMultipart(d)
+}
+
+var (
+	_ Client = (*RepSocket)(nil)
+	_ Server = (*RepSocket)(nil)
+)
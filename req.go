@@ -0,0 +1,212 @@
+package gomq
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/rand"
+	"net"
+	"sync"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// ReqSocket is a ZMQ_REQ socket type.
+// See: https://rfc.zeromq.org/spec:28
+type ReqSocket struct {
+	*Socket
+
+	mu        sync.Mutex
+	relaxed   bool
+	correlate bool
+	pending   bool          // a request was sent and its reply not received yet
+	peer      string        // routing id of the peer the request was sent to
+	lost      chan struct{} // closed once the peer is removed
+	requestID uint32
+}
+
+// errReqPeerLost is returned by Recv once the peer of the
+// pending request is gone.
+var errReqPeerLost = errors.New("gomq: req socket lost the peer of the pending request")
+
+// NewReq accepts a zmtp.SecurityMechanism and returns
+// a ReqSocket.
+func NewReq(mechanism zmtp.SecurityMechanism) *ReqSocket {
+	return &ReqSocket{
+		Socket:    NewSocket(false, zmtp.ReqSocketType, nil, mechanism),
+		requestID: rand.Uint32(),
+	}
+}
+
+// Bind accepts a zeromq endpoint and binds the
+// req socket to it. The endpoint string should be in
+// the format "<proto>://<address>", e.g.
+// "tcp://<address>:<port>" or "ipc://<path>".
+func (r *ReqSocket) Bind(endpoint string) (net.Addr, error) {
+	return BindServer(r, endpoint)
+}
+
+// Connect accepts a zeromq endpoint and connects the
+// req socket to it. The endpoint string should be in
+// the format "<proto>://<address>", e.g.
+// "tcp://<address>:<port>" or "ipc://<path>".
+func (r *ReqSocket) Connect(endpoint string) error {
+	return ConnectClient(r, endpoint)
+}
+
+// SetRelaxed enables or disables the relaxed mode (ZMQ_REQ_RELAXED).
+// In relaxed mode, a new request may be sent before the reply to
+// the previous one was received. The pending reply is then discarded.
+func (r *ReqSocket) SetRelaxed(relaxed bool) {
+	r.mu.Lock()
+	r.relaxed = relaxed
+	r.mu.Unlock()
+}
+
+// SetCorrelate enables or disables the correlate mode (ZMQ_REQ_CORRELATE).
+// In correlate mode, each request is prefixed with a request id frame
+// and replies that do not carry the id of the pending request are
+// discarded.
+func (r *ReqSocket) SetCorrelate(correlate bool) {
+	r.mu.Lock()
+	r.correlate = correlate
+	r.mu.Unlock()
+}
+
+// Send sends a single frame request.
+func (r *ReqSocket) Send(b []byte) error {
+	return r.SendMultipart([][]byte{b})
+}
+
+// SendMultipart sends a request to the next peer, in round-robin
+// order. It returns an error if the reply to the previous request
+// was not received yet, unless the socket is in relaxed mode.
+func (r *ReqSocket) SendMultipart(b [][]byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.pending && !r.relaxed {
+		return errors.New("gomq: req socket cannot send a request before receiving the previous reply")
+	}
+
+	conn, err := r.nextConnection()
+	if err != nil {
+		return err
+	}
+
+	var envelope [][]byte
+	if r.correlate {
+		r.requestID++
+		id := make([]byte, 4)
+		binary.BigEndian.PutUint32(id, r.requestID)
+		envelope = append(envelope, id)
+	}
+	envelope = append(envelope, nil) // empty delimiter
+
+	d := make([][]byte, 0, len(envelope)+len(b))
+	d = append(d, envelope...)
+	d = append(d, b...)
+	if err := conn.zmtp.SendMultipart(d); err != nil {
+		return err
+	}
+
+	r.pending = true
+	r.peer = conn.id
+	r.lost = make(chan struct{})
+	return nil
+}
+
+// RemoveConnection removes the connection of a peer. If the
+// pending request was sent to it, the request is dropped, so
+// that Recv returns an error and a new request may be sent.
+func (r *ReqSocket) RemoveConnection(uuid string) {
+	r.Socket.RemoveConnection(uuid)
+
+	r.mu.Lock()
+	if r.pending && r.peer == uuid {
+		r.pending = false
+		close(r.lost)
+	}
+	r.mu.Unlock()
+}
+
+// Recv receives a reply and returns its first frame.
+func (r *ReqSocket) Recv() ([]byte, error) {
+	msg, err := r.RecvMultipart()
+	if err != nil {
+		return nil, err
+	}
+	if len(msg) == 0 {
+		return nil, nil
+	}
+	return msg[0], nil
+}
+
+// RecvMultipart receives the reply to the pending request, stripped
+// from its envelope. Messages that are not a reply to the pending
+// request are discarded. In relaxed mode, requests may be sent
+// while it waits, it then returns the reply to the latest one.
+// It returns an error if the peer of the request is removed.
+func (r *ReqSocket) RecvMultipart() ([][]byte, error) {
+	r.mu.Lock()
+	pending, lost := r.pending, r.lost
+	r.mu.Unlock()
+
+	if !pending {
+		return nil, errors.New("gomq: req socket cannot receive before sending a request")
+	}
+
+	for {
+		var msg *zmtp.Message
+		select {
+		case msg = <-r.recvChannel:
+		case <-lost:
+			r.mu.Lock()
+			pending, current := r.pending, r.lost
+			r.mu.Unlock()
+			if !pending || current == lost {
+				return nil, errReqPeerLost
+			}
+			lost = current // a new request was sent meanwhile
+			continue
+		}
+		if msg.Err != nil {
+			return nil, msg.Err
+		}
+
+		r.mu.Lock()
+		frames, ok := r.reply(msg)
+		lost = r.lost
+		r.mu.Unlock()
+		if ok {
+			return frames, nil
+		}
+	}
+}
+
+// reply returns the frames of msg if it is the reply to the
+// pending request. It must be called with r.mu held.
+func (r *ReqSocket) reply(msg *zmtp.Message) ([][]byte, bool) {
+	if !r.pending || msg.MessageType != zmtp.UserMessage || msg.RoutingID != r.peer {
+		return nil, false
+	}
+
+	frames := msg.Body
+	if r.correlate {
+		if len(frames) == 0 || len(frames[0]) != 4 ||
+			binary.BigEndian.Uint32(frames[0]) != r.requestID {
+			return nil, false
+		}
+		frames = frames[1:]
+	}
+	if len(frames) == 0 || len(frames[0]) != 0 {
+		return nil, false
+	}
+
+	r.pending = false
+	return frames[1:], true
+}
+
+var (
+	_ Client = (*ReqSocket)(nil)
+	_ Server = (*ReqSocket)(nil)
+)
@@ -0,0 +1,88 @@
+package gomq
+
+import (
+	"errors"
+	"net"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// RouterSocket is a ZMQ_ROUTER socket type.
+// See: https://rfc.zeromq.org/spec:28
+type RouterSocket struct {
+	*Socket
+}
+
+// NewRouter accepts a zmtp.SecurityMechanism and returns
+// a RouterSocket.
+func NewRouter(mechanism zmtp.SecurityMechanism) *RouterSocket {
+	return &RouterSocket{
+		Socket: NewSocket(true, zmtp.RouterSocketType, nil, mechanism),
+	}
+}
+
+// Bind accepts a zeromq endpoint and binds the
+// router socket to it. The endpoint string should be in
+// the format "<proto>://<address>", e.g.
+// "tcp://<address>:<port>" or "ipc://<path>".
+func (r *RouterSocket) Bind(endpoint string) (net.Addr, error) {
+	return BindServer(r, endpoint)
+}
+
+// Connect accepts a zeromq endpoint and connects the
+// router socket to it. The endpoint string should be in
+// the format "<proto>://<address>", e.g.
+// "tcp://<address>:<port>" or "ipc://<path>".
+func (r *RouterSocket) Connect(endpoint string) error {
+	return ConnectClient(r, endpoint)
+}
+
+// Recv is not supported by router sockets, as the
+// routing id of the peer would be lost. Use RecvMultipart.
+func (r *RouterSocket) Recv() ([]byte, error) {
+	return nil, errors.New("gomq: router sockets only support RecvMultipart")
+}
+
+// Send is not supported by router sockets, as a message
+// needs a routing id. Use SendMultipart.
+func (r *RouterSocket) Send(b []byte) error {
+	return errors.New("gomq: router sockets only support SendMultipart")
+}
+
+// RecvMultipart receives a message from any peer. The
+// routing id of the peer is prepended as the first frame.
+func (r *RouterSocket) RecvMultipart() ([][]byte, error) {
+	for {
+		msg := <-r.recvChannel
+		if msg.Err != nil {
+			return nil, msg.Err
+		}
+		if msg.MessageType != zmtp.UserMessage {
+			continue
+		}
+
+		frames := make([][]byte, 0, len(msg.Body)+1)
+		frames = append(frames, []byte(msg.RoutingID))
+		return append(frames, msg.Body...), nil
+	}
+}
+
+// SendMultipart sends a message to the peer whose routing
+// id is the first frame of b. The remaining frames are sent
+// as is.
+func (r *RouterSocket) SendMultipart(b [][]byte) error {
+	if len(b) == 0 {
+		return errors.New("gomq: router message needs a routing id frame")
+	}
+
+	conn, err := r.GetConnection(string(b[0]))
+	if err != nil {
+		return err
+	}
+	return conn.zmtp.SendMultipart(b[1:])
+}
+
+var (
+	_ Client = (*RouterSocket)(nil)
+	_ Server = (*RouterSocket)(nil)
+)
@@ -0,0 +1,72 @@
+package gomq
+
+import (
+	"errors"
+	"net"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// ScatterSocket is a ZMQ_SCATTER socket type.
+// It is goroutine safe.
+type ScatterSocket struct {
+	*Socket
+}
+
+// NewScatter accepts a zmtp.SecurityMechanism and returns
+// a ScatterSocket.
+func NewScatter(mechanism zmtp.SecurityMechanism) *ScatterSocket {
+	return &ScatterSocket{
+		Socket: NewSocket(false, zmtp.ScatterSocketType, nil, mechanism),
+	}
+}
+
+// Bind accepts a zeromq endpoint and binds the
+// scatter socket to it. The endpoint string should be in
+// the format "<proto>://<address>", e.g.
+// "tcp://<address>:<port>" or "ipc://<path>".
+func (s *ScatterSocket) Bind(endpoint string) (net.Addr, error) {
+	return BindServer(s, endpoint)
+}
+
+// Connect accepts a zeromq endpoint and connects the
+// scatter socket to it. The endpoint string should be in
+// the format "<proto>://<address>", e.g.
+// "tcp://<address>:<port>" or "ipc://<path>".
+func (s *ScatterSocket) Connect(endpoint string) error {
+	return ConnectClient(s, endpoint)
+}
+
+// Recv is not supported by scatter sockets.
+func (s *ScatterSocket) Recv() ([]byte, error) {
+	return nil, errors.New("gomq: scatter sockets cannot receive messages")
+}
+
+// RecvMultipart is not supported by scatter sockets.
+func (s *ScatterSocket) RecvMultipart() ([][]byte, error) {
+	return nil, errors.New("gomq: scatter sockets cannot receive messages")
+}
+
+// Send sends a message to the next peer, in
+// round-robin order.
+func (s *ScatterSocket) Send(b []byte) error {
+	conn, err := s.nextConnection()
+	if err != nil {
+		return err
+	}
+	return conn.zmtp.SendFrame(b)
+}
+
+// SendMultipart sends a single frame message. Scatter
+// sockets do not support multipart messages.
+func (s *ScatterSocket) SendMultipart(b [][]byte) error {
+	if len(b) != 1 {
+		return errors.New("gomq: scatter sockets do not support multipart messages")
+	}
+	return s.Send(b[0])
+}
+
+var (
+	_ Client = (*ScatterSocket)(nil)
+	_ Server = (*ScatterSocket)(nil)
+)
@@ -21,9 +21,9 @@ func NewServer(mechanism zmtp.SecurityMechanism) Server {
 }
 
 // Bind accepts a zeromq endpoint and binds the
-// server socket to it. Currently the only transport
-// supported is TCP. The endpoint string should be
-// in the format "tcp://<address>:<port>".
+// server socket to it. The endpoint string should be in
+// the format "<proto>://<address>", e.g.
+// "tcp://<address>:<port>" or "ipc://<path>".
 func (s *ServerSocket) Bind(endpoint string) (net.Addr, error) {
 	return BindServer(s, endpoint)
 }
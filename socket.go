@@ -1,6 +1,7 @@
 package gomq
 
 import (
+	"crypto/tls"
 	"errors"
 	"sync"
 	"time"
@@ -17,9 +18,18 @@ type Socket struct {
 	asServer      bool
 	conns         map[string]*Connection
 	ids           []string
+	next          int
 	retryInterval time.Duration
 	lock          *sync.RWMutex
 	mechanism     zmtp.SecurityMechanism
+	tlsConfig     *tls.Config
+	zapDomain     string
+	zapHandler    zmtp.ZAPHandler
+	allowZMTP20   bool
+	pingIvl       time.Duration
+	pingTimeout   time.Duration
+	pingTTL       time.Duration
+	isClosed      bool
 	recvChannel   chan *zmtp.Message
 }
 
@@ -40,43 +50,72 @@ func NewSocket(asServer bool, sockType zmtp.SocketType, sockID zmtp.SocketIdenti
 }
 
 // AddConnection adds a gomq.Connection to the socket.
+// A connection whose identity is already in use replaces
+// the previous one, which is closed, as libzmq ROUTER sockets
+// do with ZMQ_ROUTER_HANDOVER set.
 // It is goroutine safe.
 func (s *Socket) AddConnection(conn *Connection) {
-	s.lock.Lock()
 	uuid, err := conn.zmtp.GetIdentity()
 	if err != nil || uuid == "" {
 		uuid, _ = newUUID()
 	}
+	s.addConnection(conn, uuid)
+}
 
+// addConnection adds conn to the socket, with the routing
+// id uuid, as AddConnection does.
+func (s *Socket) addConnection(conn *Connection, uuid string) {
+	s.lock.Lock()
+	conn.id = uuid
+	if old, ok := s.conns[uuid]; ok {
+		old.zmtp.Close()
+	} else {
+		s.ids = append(s.ids, uuid)
+	}
 	s.conns[uuid] = conn
-	s.ids = append(s.ids, uuid)
 	s.lock.Unlock()
 }
 
 // RemoveConnection accepts the uuid of a connection
 // and removes that gomq.Connection from the socket
-// if it exists. FIXME will bomb if uuid does not
-// exist in map
+// if it exists.
 func (s *Socket) RemoveConnection(uuid string) {
 	s.lock.Lock()
 	defer s.lock.Unlock()
 	for k, v := range s.ids {
 		if v == uuid {
 			s.ids = append(s.ids[:k], s.ids[k+1:]...)
-			s.conns[uuid].net.Close()
+			s.conns[uuid].zmtp.Close()
 			delete(s.conns, uuid)
+			break
 		}
 	}
 }
 
 // GetConnection returns the connection by identity
 func (s *Socket) GetConnection(uuid string) (*Connection, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
 	if conns, ok := s.conns[uuid]; ok {
 		return conns, nil
 	}
 	return nil, errors.New("conn not exist")
 }
 
+// nextConnection returns the next connection of the
+// socket, in round-robin order. It is goroutine safe.
+func (s *Socket) nextConnection() (*Connection, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.ids) == 0 {
+		return nil, errors.New("no connection available")
+	}
+	s.next %= len(s.ids)
+	conn := s.conns[s.ids[s.next]]
+	s.next++
+	return conn, nil
+}
+
 // RetryInterval returns the retry interval used
 // for asyncronous bind / connect.
 func (s *Socket) RetryInterval() time.Duration {
@@ -98,27 +137,103 @@ func (s *Socket) SecurityMechanism() zmtp.SecurityMechanism {
 	return s.mechanism
 }
 
+// SetTLSConfig sets the TLS config used by the socket on
+// tls:// and wss:// endpoints. Binding to a tls:// endpoint
+// needs a config holding a certificate. It must be called
+// before Bind or Connect.
+func (s *Socket) SetTLSConfig(config *tls.Config) {
+	s.tlsConfig = config
+}
+
+// TLSConfig returns the TLS config set with SetTLSConfig.
+func (s *Socket) TLSConfig() *tls.Config {
+	return s.tlsConfig
+}
+
+// SetZMTP20Allowed sets whether the socket may talk to peers
+// speaking ZMTP 2.0, e.g. libzmq 3.x, which are refused by
+// default. It must be called before Bind or Connect.
+func (s *Socket) SetZMTP20Allowed(allowed bool) {
+	s.allowZMTP20 = allowed
+}
+
+// ZMTP20Allowed returns whether the socket may talk to
+// ZMTP 2.0 peers.
+func (s *Socket) ZMTP20Allowed() bool {
+	return s.allowZMTP20
+}
+
+// SetHeartbeatIvl sets the interval between the PINGs sent
+// to the peers of the socket, as ZMQ_HEARTBEAT_IVL does. No
+// PING is sent if it is zero, the default. It must be called
+// before Bind or Connect.
+// See: https://rfc.zeromq.org/spec:37
+func (s *Socket) SetHeartbeatIvl(ivl time.Duration) {
+	s.pingIvl = ivl
+}
+
+// SetHeartbeatTimeout sets how long to wait for a peer to send
+// anything once a PING is sent, before closing the connection,
+// as ZMQ_HEARTBEAT_TIMEOUT does. Connected endpoints are then
+// connected again. It defaults to the heartbeat interval. It
+// must be called before Bind or Connect.
+func (s *Socket) SetHeartbeatTimeout(timeout time.Duration) {
+	s.pingTimeout = timeout
+}
+
+// SetHeartbeatTTL sets the TTL sent in PINGs, for peers to close
+// the connection if they receive nothing from the socket within
+// it, as ZMQ_HEARTBEAT_TTL does. It is rounded down to tenths of
+// seconds. It must be called before Bind or Connect.
+func (s *Socket) SetHeartbeatTTL(ttl time.Duration) {
+	s.pingTTL = ttl
+}
+
+// heartbeat returns the heartbeat options of the socket.
+func (s *Socket) heartbeat() (ivl, timeout, ttl time.Duration) {
+	return s.pingIvl, s.pingTimeout, s.pingTTL
+}
+
 // RecvChannel returns the Socket's receive channel used
 // for receiving messages.
 func (s *Socket) RecvChannel() chan *zmtp.Message {
 	return s.recvChannel
 }
 
+// base returns the Socket embedded by typed sockets.
+func (s *Socket) base() *Socket {
+	return s
+}
+
 // Close closes all underlying transport connections
-// for the socket.
+// for the socket, and unbinds its inproc endpoints.
 func (s *Socket) Close() {
+	unbindInproc(s)
+
 	s.lock.Lock()
-	for k, v := range s.ids {
-		s.conns[v].net.Close()
-		s.ids = append(s.ids[:k], s.ids[k+1:]...)
+	s.isClosed = true
+	for _, id := range s.ids {
+		s.conns[id].zmtp.Close()
+		delete(s.conns, id)
 	}
+	s.ids = s.ids[:0]
 	s.lock.Unlock()
 }
 
+// closed reports whether the socket was closed.
+func (s *Socket) closed() bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.isClosed
+}
+
 // Recv receives a message from the Socket's
 // message channel and returns it.
 func (s *Socket) Recv() ([]byte, error) {
 	msg := <-s.recvChannel
+	if msg.Err != nil {
+		return nil, msg.Err
+	}
 	if msg.MessageType == zmtp.CommandMessage {
 	}
 	return msg.Body[0], msg.Err
@@ -2,8 +2,24 @@ package gomq
 
 import (
 	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/big"
 	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/zeromq/gomq/internal/test"
 	"github.com/zeromq/gomq/zmtp"
@@ -262,8 +278,2044 @@ func TestDealerExtRouter(t *testing.T) {
 
 func TestBadEndpointError(t *testing.T) {
 	client := NewClient(zmtp.NewSecurityNull())
-	err := client.Connect("ipc://@/not-yet-implemented")
+	err := client.Connect("foo://@/not-implemented")
 	if err == nil {
-		t.Error("ipc protocol MUST raise error")
+		t.Error("foo protocol MUST raise error")
+	}
+}
+
+func TestRouterDealer(t *testing.T) {
+	router := NewRouter(zmtp.NewSecurityNull())
+	defer router.Close()
+
+	_, err := router.Bind("tcp://127.0.0.1:19002")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dealer := NewDealer(zmtp.NewSecurityNull(), "dealer-id")
+	defer dealer.Close()
+
+	err = dealer.Connect("tcp://127.0.0.1:19002")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = dealer.SendMultipart([][]byte{[]byte("HELLO")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := router.RecvMultipart()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := 3, len(msg); want != got {
+		t.Fatalf("want %v frames, got %v (%q)", want, got, msg)
+	}
+
+	if want, got := "dealer-id", string(msg[0]); want != got {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+
+	if want, got := "HELLO", string(msg[2]); want != got {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+
+	err = router.SendMultipart([][]byte{msg[0], []byte("WORLD")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reply, err := dealer.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := "WORLD", string(reply); want != got {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+
+	err = router.SendMultipart([][]byte{[]byte("unknown-id"), []byte("WORLD")})
+	if err == nil {
+		t.Fatal("sending to an unknown peer MUST raise error")
+	}
+}
+
+// pipeConnection returns a connection of a ROUTER socket,
+// whose other end is a DEALER with the given identity.
+func pipeConnection(t *testing.T, id string) *Connection {
+	a, b := zmtp.NewPipe()
+	go b.Prepare(zmtp.NewSecurityNull(), zmtp.DealerSocketType, zmtp.SocketIdentity(id), false, nil)
+	if _, err := a.Prepare(zmtp.NewSecurityNull(), zmtp.RouterSocketType, nil, true, nil); err != nil {
+		t.Fatal(err)
+	}
+	return NewConnection(nil, a)
+}
+
+func TestRouterDuplicateIdentity(t *testing.T) {
+	router := NewRouter(zmtp.NewSecurityNull())
+	defer router.Close()
+
+	first := pipeConnection(t, "dup-id")
+	router.AddConnection(first)
+	second := pipeConnection(t, "dup-id")
+	router.AddConnection(second)
+
+	if want, got := 1, len(router.ids); want != got {
+		t.Fatalf("want %v routing id, got %v", want, got)
+	}
+
+	// the latest connection replaces the previous one
+	conn, err := router.GetConnection("dup-id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conn != second {
+		t.Fatal("want the connection to be replaced")
+	}
+	if err := first.zmtp.SendFrame([]byte("HELLO")); err == nil {
+		t.Fatal("want the replaced connection to be closed")
+	}
+
+	router.RemoveConnection("dup-id")
+	router.RemoveConnection("dup-id")
+	if _, err := router.GetConnection("dup-id"); err == nil {
+		t.Fatal("want the connection to be removed")
+	}
+}
+
+func TestReqRouter(t *testing.T) {
+	router := NewRouter(zmtp.NewSecurityNull())
+	defer router.Close()
+
+	_, err := router.Bind("tcp://127.0.0.1:19003")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := NewReq(zmtp.NewSecurityNull())
+	defer req.Close()
+
+	err = req.Connect("tcp://127.0.0.1:19003")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := req.Recv(); err == nil {
+		t.Fatal("receiving before sending a request MUST raise error")
+	}
+
+	err = req.Send([]byte("HELLO"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := req.Send([]byte("HELLO")); err == nil {
+		t.Fatal("sending twice without receiving MUST raise error")
+	}
+
+	msg, err := router.RecvMultipart()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := 3, len(msg); want != got {
+		t.Fatalf("want %v frames, got %v (%q)", want, got, msg)
+	}
+
+	if want, got := 0, len(msg[1]); want != got {
+		t.Fatalf("want empty delimiter, got %q", msg[1])
+	}
+
+	err = router.SendMultipart([][]byte{msg[0], nil, []byte("WORLD")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reply, err := req.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := "WORLD", string(reply); want != got {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+
+	req.SetRelaxed(true)
+	req.SetCorrelate(true)
+
+	for _, body := range []string{"FIRST", "SECOND"} {
+		err = req.Send([]byte(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var ids [][]byte
+	for i := 0; i < 2; i++ {
+		msg, err := router.RecvMultipart()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if want, got := 4, len(msg); want != got {
+			t.Fatalf("want %v frames, got %v (%q)", want, got, msg)
+		}
+		ids = append(ids, msg[1])
+	}
+
+	for i, body := range []string{"STALE", "FRESH"} {
+		err = router.SendMultipart([][]byte{msg[0], ids[i], nil, []byte(body)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reply, err = req.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := "FRESH", string(reply); want != got {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+}
+
+func TestReqRelaxedResend(t *testing.T) {
+	router := NewRouter(zmtp.NewSecurityNull())
+	defer router.Close()
+
+	addr, err := router.Bind("tcp://127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := NewReq(zmtp.NewSecurityNull())
+	req.SetRelaxed(true)
+	defer req.Close()
+
+	err = req.Connect("tcp://" + addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type result struct {
+		msg []byte
+		err error
+	}
+	recv := func() <-chan result {
+		results := make(chan result, 1)
+		go func() {
+			msg, err := req.Recv()
+			results <- result{msg, err}
+		}()
+		return results
+	}
+
+	err = req.Send([]byte("LOST"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := router.RecvMultipart(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the request is sent again while waiting for its reply
+	results := recv()
+	time.Sleep(100 * time.Millisecond)
+	sent := make(chan error, 1)
+	go func() { sent <- req.Send([]byte("HELLO")) }()
+	select {
+	case err := <-sent:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("want the request to be sent while waiting for a reply")
+	}
+
+	msg, err := router.RecvMultipart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := router.SendMultipart([][]byte{msg[0], nil, []byte("WORLD")}); err != nil {
+		t.Fatal(err)
+	}
+
+	res := <-results
+	if res.err != nil {
+		t.Fatal(res.err)
+	}
+	if want, got := "WORLD", string(res.msg); want != got {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+
+	// the peer of the pending request disconnects
+	err = req.Send([]byte("HELLO"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	results = recv()
+	router.Close()
+
+	select {
+	case res := <-results:
+		if res.err == nil {
+			t.Fatal("want error once the peer of the request is gone")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("want Recv to return once the peer of the request is gone")
+	}
+}
+
+func TestReqRep(t *testing.T) {
+	rep := NewRep(zmtp.NewSecurityNull())
+	defer rep.Close()
+
+	_, err := rep.Bind("tcp://127.0.0.1:19004")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := NewReq(zmtp.NewSecurityNull())
+	defer req.Close()
+
+	err = req.Connect("tcp://127.0.0.1:19004")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := rep.Send([]byte("WORLD")); err == nil {
+		t.Fatal("replying before receiving a request MUST raise error")
+	}
+
+	for i := 0; i < 2; i++ {
+		err = req.SendMultipart([][]byte{[]byte("HELLO"), []byte("AGAIN")})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		msg, err := rep.RecvMultipart()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if want, got := 2, len(msg); want != got {
+			t.Fatalf("want %v frames, got %v (%q)", want, got, msg)
+		}
+
+		if want, got := "HELLO", string(msg[0]); want != got {
+			t.Fatalf("want %q, got %q", want, got)
+		}
+
+		if _, err := rep.Recv(); err == nil {
+			t.Fatal("receiving twice without replying MUST raise error")
+		}
+
+		err = rep.Send([]byte("WORLD"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		reply, err := req.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if want, got := "WORLD", string(reply); want != got {
+			t.Fatalf("want %q, got %q", want, got)
+		}
+	}
+}
+
+func TestPubFilter(t *testing.T) {
+	pub := NewPub(zmtp.NewSecurityNull())
+	defer pub.Close()
+
+	_, err := pub.Bind("tcp://127.0.0.1:19005")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	netConn, err := net.Dial("tcp", "127.0.0.1:19005")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer netConn.Close()
+
+	sub := zmtp.NewConnection(netConn)
+	_, err = sub.Prepare(zmtp.NewSecurityNull(), zmtp.SubSocketType, nil, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, cmd := range []struct{ name, topic string }{
+		{"SUBSCRIBE", "weather"},
+		{"SUBSCRIBE", "news"},
+		{"CANCEL", "news"},
+	} {
+		err = sub.SendCommand(cmd.name, []byte(cmd.topic))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	for _, topic := range []string{"news", "sports", "weather"} {
+		err = pub.SendMultipart([][]byte{[]byte(topic), []byte("update")})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	msgs := make(chan *zmtp.Message)
+	sub.RecvMultipart(msgs)
+
+	msg := <-msgs
+	if msg.Err != nil {
+		t.Fatal(msg.Err)
+	}
+
+	if want, got := "weather", string(msg.Body[0]); want != got {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+}
+
+// brokenConn is a connection whose writes fail.
+type brokenConn struct{}
+
+func (brokenConn) Read(b []byte) (int, error)  { return 0, io.EOF }
+func (brokenConn) Write(b []byte) (int, error) { return 0, errors.New("broken connection") }
+
+func TestPubBrokenSubscriber(t *testing.T) {
+	pub := NewPub(zmtp.NewSecurityNull())
+	defer pub.Close()
+
+	addr, err := pub.Bind("tcp://127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	broken := NewConnection(nil, zmtp.NewConnection(brokenConn{}))
+	pub.AddConnection(broken)
+	pub.handleCommand(broken, "SUBSCRIBE", nil)
+
+	sub := NewSub(zmtp.NewSecurityNull())
+	defer sub.Close()
+
+	err = sub.Subscribe(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = sub.Connect("tcp://" + addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	err = pub.Send([]byte("HELLO"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := sub.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := "HELLO", string(msg); want != got {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+}
+
+// stalledConn is a connection whose writes block
+// until release is closed.
+type stalledConn struct {
+	release chan struct{}
+}
+
+func (c stalledConn) Read(b []byte) (int, error) {
+	<-c.release
+	return 0, io.EOF
+}
+
+func (c stalledConn) Write(b []byte) (int, error) {
+	<-c.release
+	return 0, errors.New("stalled connection")
+}
+
+func TestPubStalledSubscriber(t *testing.T) {
+	pub := NewPub(zmtp.NewSecurityNull())
+	defer pub.Close()
+
+	release := make(chan struct{})
+	defer close(release)
+
+	stalled := NewConnection(nil, zmtp.NewConnection(stalledConn{release}))
+	pub.AddConnection(stalled)
+	pub.handleCommand(stalled, "SUBSCRIBE", nil)
+
+	go pub.Send([]byte("HELLO"))
+	time.Sleep(100 * time.Millisecond)
+
+	added := make(chan struct{})
+	go func() {
+		conn := NewConnection(nil, zmtp.NewConnection(brokenConn{}))
+		pub.AddConnection(conn)
+		pub.RemoveConnection(conn.id)
+		close(added)
+	}()
+
+	select {
+	case <-added:
+	case <-time.After(time.Second):
+		t.Fatal("want connections to be added while a subscriber is stalled")
+	}
+}
+
+func TestSubBrokenPublisher(t *testing.T) {
+	sub := NewSub(zmtp.NewSecurityNull())
+	defer sub.Close()
+
+	err := sub.Subscribe([]byte("topic"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	broken := NewConnection(nil, zmtp.NewConnection(brokenConn{}))
+	sub.AddConnection(broken)
+
+	if _, err := sub.GetConnection(broken.id); err == nil {
+		t.Fatal("want a publisher which cannot be subscribed to be removed")
+	}
+}
+
+func TestPubSub(t *testing.T) {
+	pub := NewPub(zmtp.NewSecurityNull())
+	defer pub.Close()
+
+	_, err := pub.Bind("tcp://127.0.0.1:19006")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sub := NewSub(zmtp.NewSecurityNull())
+	defer sub.Close()
+
+	// subscriptions made before connecting are replayed.
+	err = sub.Subscribe([]byte("weather"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = sub.Connect("tcp://127.0.0.1:19006")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = sub.Subscribe([]byte("news"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	for _, topic := range []string{"sports", "news", "weather"} {
+		err = pub.Send([]byte(topic))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, want := range []string{"news", "weather"} {
+		msg, err := sub.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := string(msg); want != got {
+			t.Fatalf("want %q, got %q", want, got)
+		}
+	}
+
+	err = sub.Unsubscribe([]byte("news"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	for _, topic := range []string{"news", "weather"} {
+		err = pub.Send([]byte(topic))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	msg, err := sub.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := "weather", string(msg); want != got {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+}
+
+func TestXSubDuplicateSubscriptions(t *testing.T) {
+	pub := NewPub(zmtp.NewSecurityNull())
+	defer pub.Close()
+
+	addr, err := pub.Bind("tcp://127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	xsub := NewXSub(zmtp.NewSecurityNull())
+	defer xsub.Close()
+
+	err = xsub.Connect("tcp://" + addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, subscription := range []string{"\x01news", "\x01news", "\x00news"} {
+		err = xsub.Send([]byte(subscription))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	// one subscription is left
+	err = pub.Send([]byte("news"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := xsub.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := "news", string(msg); want != got {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+
+	err = xsub.Send([]byte("\x00news"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	err = pub.Send([]byte("news"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case msg := <-xsub.RecvChannel():
+		t.Fatalf("want no message once all subscriptions are cancelled, got %q", msg.Body)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestXPubDisconnectWithoutReceiver(t *testing.T) {
+	xpub := NewXPub(zmtp.NewSecurityNull())
+	defer xpub.Close()
+
+	conn := NewConnection(nil, zmtp.NewConnection(brokenConn{}))
+	xpub.AddConnection(conn)
+
+	// the subscriber comes and goes while nobody receives
+	done := make(chan struct{})
+	go func() {
+		xpub.handleCommand(conn, "SUBSCRIBE", []byte("topic"))
+		xpub.RemoveConnection(conn.id)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("want the subscriber to be removed while nobody receives")
+	}
+
+	for _, want := range []string{"\x01topic", "\x00topic"} {
+		msg, err := xpub.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if want != string(msg) {
+			t.Fatalf("want %q, got %q", want, msg)
+		}
+	}
+}
+
+func TestXPubXSubForwarder(t *testing.T) {
+	pub := NewPub(zmtp.NewSecurityNull())
+	defer pub.Close()
+
+	_, err := pub.Bind("tcp://127.0.0.1:19007")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	xsub := NewXSub(zmtp.NewSecurityNull())
+	defer xsub.Close()
+
+	err = xsub.Connect("tcp://127.0.0.1:19007")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	xpub := NewXPub(zmtp.NewSecurityNull())
+	defer xpub.Close()
+
+	_, err = xpub.Bind("tcp://127.0.0.1:19008")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sub := NewSub(zmtp.NewSecurityNull())
+	defer sub.Close()
+
+	err = sub.Connect("tcp://127.0.0.1:19008")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = sub.Subscribe([]byte("weather"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subscription, err := xpub.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := "\x01weather", string(subscription); want != got {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+
+	err = xsub.Send(subscription)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	for _, topic := range []string{"news", "weather"} {
+		err = pub.Send([]byte(topic))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	msg, err := xsub.RecvMultipart()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = xpub.SendMultipart(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err = sub.RecvMultipart()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := "weather", string(msg[0]); want != got {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+
+	err = sub.Unsubscribe([]byte("weather"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cancel, err := xpub.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := "\x00weather", string(cancel); want != got {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+}
+
+func TestRadioDish(t *testing.T) {
+	radio := NewRadio(zmtp.NewSecurityNull())
+	defer radio.Close()
+
+	_, err := radio.Bind("tcp://127.0.0.1:19009")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dish := NewDish(zmtp.NewSecurityNull())
+	defer dish.Close()
+
+	err = dish.Join("weather")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := dish.Join("weather"); err == nil {
+		t.Fatal("joining a group twice MUST raise error")
+	}
+
+	err = dish.Connect("tcp://127.0.0.1:19009")
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	for _, group := range []string{"news", "weather"} {
+		err = radio.SendGroup(group, []byte("update"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	msg, err := dish.RecvMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := "weather", msg.Group; want != got {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+
+	if want, got := "update", string(msg.Body[0]); want != got {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+
+	if err := radio.Send([]byte("update")); err == nil {
+		t.Fatal("sending without a group MUST raise error")
+	}
+}
+
+func TestScatterGather(t *testing.T) {
+	gather := NewGather(zmtp.NewSecurityNull())
+	defer gather.Close()
+
+	_, err := gather.Bind("tcp://127.0.0.1:19010")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scatter := NewScatter(zmtp.NewSecurityNull())
+	defer scatter.Close()
+
+	err = scatter.Connect("tcp://127.0.0.1:19010")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := scatter.SendMultipart([][]byte{[]byte("HELLO"), []byte("WORLD")}); err == nil {
+		t.Fatal("sending a multipart message MUST raise error")
+	}
+
+	const n = 10
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			errs <- scatter.Send([]byte("HELLO"))
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+
+		msg, err := gather.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if want, got := "HELLO", string(msg); want != got {
+			t.Fatalf("want %q, got %q", want, got)
+		}
+	}
+}
+
+func TestPair(t *testing.T) {
+	server := NewPair(zmtp.NewSecurityNull())
+	defer server.Close()
+
+	_, err := server.Bind("tcp://127.0.0.1:19011")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := NewPair(zmtp.NewSecurityNull())
+	defer client.Close()
+
+	err = client.Connect("tcp://127.0.0.1:19011")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = client.SendMultipart([][]byte{[]byte("HELLO"), []byte("THERE")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := server.RecvMultipart()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := 2, len(msg); want != got {
+		t.Fatalf("want %v frames, got %v (%q)", want, got, msg)
+	}
+
+	err = server.Send([]byte("WORLD"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reply, err := client.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := "WORLD", string(reply); want != got {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+
+	// a second peer is refused after the handshake.
+	netConn, err := net.Dial("tcp", "127.0.0.1:19011")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer netConn.Close()
+
+	other := zmtp.NewConnection(netConn)
+	_, err = other.Prepare(zmtp.NewSecurityNull(), zmtp.PairSocketType, nil, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msgs := make(chan *zmtp.Message)
+	other.Recv(msgs)
+	if msg := <-msgs; msg.Err == nil {
+		t.Fatalf("second peer MUST be refused, got %q", msg.Body)
+	}
+}
+
+func TestPairDiscardedPeer(t *testing.T) {
+	pair := NewPair(zmtp.NewSecurityNull())
+	defer pair.Close()
+
+	// a peer accepted, and then discarded before being added
+	discarded := NewConnection(nil, zmtp.NewConnection(brokenConn{}))
+	if !pair.acceptConnection(discarded) {
+		t.Fatal("want the first peer to be accepted")
+	}
+
+	conn := NewConnection(nil, zmtp.NewConnection(brokenConn{}))
+	if !pair.acceptConnection(conn) {
+		t.Fatal("want a peer to be accepted once the previous one was discarded")
+	}
+	pair.AddConnection(conn)
+
+	if pair.acceptConnection(discarded) {
+		t.Fatal("want further peers to be refused")
+	}
+
+	pair.RemoveConnection(conn.id)
+	if !pair.acceptConnection(discarded) {
+		t.Fatal("want a peer to be accepted once the previous one was removed")
+	}
+}
+
+func TestPeer(t *testing.T) {
+	server := NewPeer(zmtp.NewSecurityNull())
+	defer server.Close()
+
+	_, err := server.Bind("tcp://127.0.0.1:19012")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := NewPeer(zmtp.NewSecurityNull())
+	defer client.Close()
+
+	serverID, err := client.ConnectPeer("tcp://127.0.0.1:19012")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = client.SendTo(serverID, []byte("HELLO"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clientID, msg, err := server.RecvFrom()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := "HELLO", string(msg); want != got {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+
+	err = server.SendTo(clientID, []byte("WORLD"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, msg, err := client.RecvFrom()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := serverID, id; want != got {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+
+	if want, got := "WORLD", string(msg); want != got {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+}
+
+func TestPeerRoutingID(t *testing.T) {
+	peer := NewPeer(zmtp.NewSecurityNull())
+	defer peer.Close()
+
+	a, b := zmtp.NewPipe()
+	go b.Prepare(zmtp.NewSecurityNull(), zmtp.PeerSocketType, zmtp.SocketIdentity("forged"), false, nil)
+	if _, err := a.Prepare(zmtp.NewSecurityNull(), zmtp.PeerSocketType, nil, true, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	conn := NewConnection(nil, a)
+	peer.AddConnection(conn)
+
+	if conn.id == "" || conn.id == "forged" {
+		t.Fatalf("want a routing id generated by the socket, got %q", conn.id)
+	}
+
+	if _, err := peer.GetConnection("forged"); err == nil {
+		t.Fatal("want the identity sent by the peer to be ignored")
+	}
+}
+
+func TestChannel(t *testing.T) {
+	server := NewChannel(zmtp.NewSecurityNull())
+	defer server.Close()
+
+	_, err := server.Bind("tcp://127.0.0.1:19013")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := NewChannel(zmtp.NewSecurityNull())
+	defer client.Close()
+
+	err = client.Connect("tcp://127.0.0.1:19013")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.SendMultipart([][]byte{[]byte("HELLO"), []byte("THERE")}); err == nil {
+		t.Fatal("sending a multipart message MUST raise error")
+	}
+
+	err = client.Send([]byte("HELLO"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := server.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := "HELLO", string(msg); want != got {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+}
+
+func TestStream(t *testing.T) {
+	stream := NewStream()
+	defer stream.Close()
+
+	_, err := stream.Bind("tcp://127.0.0.1:19014")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	netConn, err := net.Dial("tcp", "127.0.0.1:19014")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer netConn.Close()
+
+	msg, err := stream.RecvMultipart()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := 0, len(msg[1]); want != got {
+		t.Fatalf("want connect notification, got %q", msg[1])
+	}
+	id := msg[0]
+
+	_, err = netConn.Write([]byte("HELLO\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err = stream.RecvMultipart()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := string(id), string(msg[0]); want != got {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+
+	if want, got := "HELLO\n", string(msg[1]); want != got {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+
+	err = stream.SendMultipart([][]byte{id, []byte("WORLD\n")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 6)
+	_, err = io.ReadFull(netConn, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := "WORLD\n", string(buf); want != got {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+
+	netConn.Close()
+
+	msg, err = stream.RecvMultipart()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := 0, len(msg[1]); want != got {
+		t.Fatalf("want disconnect notification, got %q", msg[1])
+	}
+}
+
+func TestIPCPeerCredentials(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("peer credentials are only read on linux")
+	}
+
+	dir, err := ioutil.TempDir("", "gomq-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "router.sock")
+
+	router := NewRouter(zmtp.NewSecurityNull())
+	defer router.Close()
+
+	_, err = router.Bind("ipc://" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// a DEALER peer claiming another pid in its READY command
+	greeting := make([]byte, 64)
+	greeting[0], greeting[9], greeting[10], greeting[11] = 0xff, 0x7f, 3, 1
+	copy(greeting[12:], "NULL")
+	if _, err := conn.Write(greeting); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(conn, greeting); err != nil {
+		t.Fatal(err)
+	}
+
+	ready := []byte("\x05READY")
+	for _, p := range [][2]string{{"Socket-Type", "DEALER"}, {"Peer-Pid", "1"}} {
+		ready = append(ready, byte(len(p[0])))
+		ready = append(ready, p[0]...)
+		ready = append(ready, 0, 0, 0, byte(len(p[1])))
+		ready = append(ready, p[1]...)
+	}
+	if _, err := conn.Write(append([]byte{0x04, byte(len(ready))}, ready...)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Write([]byte("\x00\x05HELLO")); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := router.RecvMultipart()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	peer, err := router.GetConnection(string(msg[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pid, _ := peer.Metadata("Peer-Pid")
+	if want, got := strconv.Itoa(os.Getpid()), pid; want != got {
+		t.Fatalf("want peer pid %q, got %q", want, got)
+	}
+}
+
+func TestIPC(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gomq-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "router.sock")
+
+	// leave a stale socket file behind.
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	ln.Close()
+
+	router := NewRouter(zmtp.NewSecurityNull())
+	defer router.Close()
+
+	_, err = router.Bind("ipc://" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := NewReq(zmtp.NewSecurityNull())
+	defer req.Close()
+
+	err = req.Connect("ipc://" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = req.Send([]byte("HELLO"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := router.RecvMultipart()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := "HELLO", string(msg[2]); want != got {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+
+	conn, err := router.GetConnection(string(msg[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if runtime.GOOS == "linux" {
+		pid, _ := conn.Metadata("Peer-Pid")
+		if want, got := strconv.Itoa(os.Getpid()), pid; want != got {
+			t.Fatalf("want peer pid %q, got %q", want, got)
+		}
+	}
+}
+
+func TestInproc(t *testing.T) {
+	rep := NewRep(zmtp.NewSecurityNull())
+	defer rep.Close()
+
+	addr, err := rep.Bind("inproc://test-inproc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := "test-inproc", addr.String(); want != got {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+
+	if _, err := NewRep(zmtp.NewSecurityNull()).Bind("inproc://test-inproc"); err == nil {
+		t.Fatal("binding twice to an inproc endpoint MUST raise error")
+	}
+
+	req := NewReq(zmtp.NewSecurityNull())
+	defer req.Close()
+
+	err = req.Connect("inproc://test-inproc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		err = req.Send([]byte("HELLO"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		msg, err := rep.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if want, got := "HELLO", string(msg); want != got {
+			t.Fatalf("want %q, got %q", want, got)
+		}
+
+		err = rep.Send([]byte("WORLD"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		msg, err = req.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if want, got := "WORLD", string(msg); want != got {
+			t.Fatalf("want %q, got %q", want, got)
+		}
+	}
+
+	push := NewPush(zmtp.NewSecurityNull())
+	defer push.Close()
+
+	if err := push.Connect("inproc://test-inproc"); err == nil {
+		t.Fatal("connecting incompatible sockets MUST raise error")
+	}
+
+	rep.Close()
+
+	rebound := NewRep(zmtp.NewSecurityNull())
+	defer rebound.Close()
+
+	if _, err := rebound.Bind("inproc://test-inproc"); err != nil {
+		t.Fatalf("binding to an inproc endpoint of a closed socket MUST succeed: %v", err)
+	}
+}
+
+// prefixTransport is a Transport for tests, dialing
+// and listening over tcp on the loopback interface.
+type prefixTransport struct{}
+
+func (prefixTransport) Dial(address string) (net.Conn, error) {
+	return net.Dial("tcp", "127.0.0.1:"+address)
+}
+
+func (prefixTransport) Listen(address string) (net.Listener, error) {
+	return net.Listen("tcp", "127.0.0.1:"+address)
+}
+
+func TestRegisterTransport(t *testing.T) {
+	RegisterTransport("loopback", prefixTransport{})
+
+	pull := NewPull(zmtp.NewSecurityNull())
+	defer pull.Close()
+
+	addr, err := pull.Bind("loopback://19015")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := "127.0.0.1:19015", addr.String(); want != got {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+
+	push := NewPush(zmtp.NewSecurityNull())
+	defer push.Close()
+
+	err = push.Connect("loopback://19015")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = push.Send([]byte("HELLO"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := pull.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := "HELLO", string(msg); want != got {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+}
+
+func TestRegisterTransportInproc(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("registering the inproc scheme MUST panic")
+		}
+	}()
+
+	RegisterTransport("inproc", prefixTransport{})
+}
+
+func TestWebSocket(t *testing.T) {
+	rep := NewRep(zmtp.NewSecurityNull())
+	defer rep.Close()
+
+	_, err := rep.Bind("ws://127.0.0.1:19016/zmq")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := NewReq(zmtp.NewSecurityNull())
+	defer req.Close()
+
+	err = req.Connect("ws://127.0.0.1:19016/zmq")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = req.SendMultipart([][]byte{[]byte("HELLO"), []byte("WORLD")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := rep.RecvMultipart()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := "HELLO WORLD", string(bytes.Join(msg, []byte(" "))); want != got {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+
+	err = rep.Send([]byte("BYE"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reply, err := req.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := "BYE", string(reply); want != got {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+}
+
+func TestWebSocketMechanism(t *testing.T) {
+	pull := NewPull(zmtp.NewSecurityPlainServer(func(username, password string) error {
+		return nil
+	}))
+	defer pull.Close()
+
+	_, err := pull.Bind("ws://127.0.0.1:19019/zmq")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	null := NewPush(zmtp.NewSecurityNull())
+	defer null.Close()
+
+	if err := null.Connect("ws://127.0.0.1:19019/zmq"); err == nil {
+		t.Fatal("connecting with another security mechanism MUST raise error")
+	}
+
+	push := NewPush(zmtp.NewSecurityPlainClient("admin", "secret"))
+	defer push.Close()
+
+	err = push.Connect("ws://127.0.0.1:19019/zmq")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = push.Send([]byte("HELLO"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := pull.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := "HELLO", string(msg); want != got {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+}
+
+// testCertificate returns a self-signed certificate for
+// 127.0.0.1, with the given common name.
+func testCertificate(t *testing.T, commonName string) (tls.Certificate, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, cert
+}
+
+func TestTLS(t *testing.T) {
+	serverCert, serverX509 := testCertificate(t, "server")
+	clientCert, clientX509 := testCertificate(t, "client")
+
+	serverRoots := x509.NewCertPool()
+	serverRoots.AddCert(clientX509)
+	clientRoots := x509.NewCertPool()
+	clientRoots.AddCert(serverX509)
+
+	router := NewRouter(zmtp.NewSecurityNull())
+	defer router.Close()
+
+	// binding needs a certificate.
+	_, err := router.Bind("tls://127.0.0.1:19017")
+	if err == nil {
+		t.Fatal("want error binding without a certificate")
+	}
+
+	router.SetTLSConfig(&tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    serverRoots,
+	})
+	_, err = router.Bind("tls://127.0.0.1:19017")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := NewReq(zmtp.NewSecurityNull())
+	defer req.Close()
+
+	req.SetTLSConfig(&tls.Config{
+		Certificates: []tls.Certificate{clientCert},
+		RootCAs:      clientRoots,
+	})
+	err = req.Connect("tls://127.0.0.1:19017")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = req.Send([]byte("HELLO"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := router.RecvMultipart()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := "HELLO", string(msg[2]); want != got {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+
+	conn, err := router.GetConnection(string(msg[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subject, _ := conn.Metadata("Peer-Subject")
+	if want, got := "CN=client", subject; want != got {
+		t.Fatalf("want peer subject %q, got %q", want, got)
+	}
+}
+
+// forgingMechanism is a security mechanism sending
+// properties of its own along with the metadata.
+type forgingMechanism struct {
+	zmtp.SecurityMechanism
+	properties map[string]string
+}
+
+func (m forgingMechanism) Handshake(rw zmtp.CommandReadWriter, asServer bool, peer zmtp.Greeting, metadata zmtp.Metadata) (zmtp.Metadata, zmtp.Codec, error) {
+	for k, v := range m.properties {
+		metadata[k] = v
+	}
+	return m.SecurityMechanism.Handshake(rw, asServer, peer, metadata)
+}
+
+func TestTLSForgedPeerSubject(t *testing.T) {
+	serverCert, serverX509 := testCertificate(t, "server")
+
+	clientRoots := x509.NewCertPool()
+	clientRoots.AddCert(serverX509)
+
+	router := NewRouter(zmtp.NewSecurityNull())
+	defer router.Close()
+
+	router.SetTLSConfig(&tls.Config{Certificates: []tls.Certificate{serverCert}})
+	_, err := router.Bind("tls://127.0.0.1:19020")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a client without certificate
+	req := NewReq(forgingMechanism{
+		SecurityMechanism: zmtp.NewSecurityNull(),
+		properties:        map[string]string{"Peer-Subject": "CN=admin"},
+	})
+	defer req.Close()
+
+	req.SetTLSConfig(&tls.Config{RootCAs: clientRoots})
+	err = req.Connect("tls://127.0.0.1:19020")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = req.Send([]byte("HELLO"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := router.RecvMultipart()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := router.GetConnection(string(msg[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if subject, ok := conn.Metadata("Peer-Subject"); ok {
+		t.Fatalf("want no peer subject, got %q", subject)
+	}
+}
+
+func TestRadioDishUDP(t *testing.T) {
+	dish := NewDish(zmtp.NewSecurityNull())
+	defer dish.Close()
+
+	_, err := dish.Bind("udp://127.0.0.1:19018")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = dish.Join("weather")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	radio := NewRadio(zmtp.NewSecurityNull())
+	defer radio.Close()
+
+	err = radio.Connect("udp://127.0.0.1:19018")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, group := range []string{"news", "weather"} {
+		err = radio.SendGroup(group, []byte("update"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	msg, err := dish.RecvMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := "weather", msg.Group; want != got {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+
+	if want, got := "update", string(msg.Body[0]); want != got {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+
+	if err := radio.SendGroup("weather", make([]byte, maxDatagramSize)); err == nil {
+		t.Fatal("sending a message larger than a datagram MUST raise error")
+	}
+}
+
+func TestZAP(t *testing.T) {
+	var addresses []string
+	pull := NewPull(zmtp.NewSecurityPlainServer(nil))
+	pull.SetZAPDomain("test")
+	pull.SetZAPHandler(func(req *zmtp.ZAPRequest) *zmtp.ZAPReply {
+		addresses = append(addresses, req.Address)
+		reply := &zmtp.ZAPReply{RequestID: req.RequestID, StatusCode: zmtp.ZAPStatusOK}
+		if req.Domain != "test" || len(req.Credentials) != 2 ||
+			string(req.Credentials[0]) != "admin" || string(req.Credentials[1]) != "secret" {
+			reply.StatusCode = zmtp.ZAPStatusDenied
+		}
+		return reply
+	})
+	defer pull.Close()
+
+	addr, err := pull.Bind("tcp://127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	push := NewPush(zmtp.NewSecurityPlainClient("admin", "secret"))
+	defer push.Close()
+
+	err = push.Connect("tcp://" + addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = push.Send([]byte("HELLO"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := pull.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := "HELLO", string(msg); want != got {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+
+	denied := NewPush(zmtp.NewSecurityPlainClient("admin", "wrong"))
+	defer denied.Close()
+
+	if err := denied.Connect("tcp://" + addr.String()); err == nil {
+		t.Fatal("connecting with wrong credentials MUST raise error")
+	}
+
+	if want, got := []string{"127.0.0.1", "127.0.0.1"}, addresses; !reflect.DeepEqual(want, got) {
+		t.Fatalf("want addresses %q, got %q", want, got)
+	}
+
+	// handler bound to the inproc ZAP endpoint
+	handler := NewRep(zmtp.NewSecurityNull())
+	defer handler.Close()
+
+	_, err = handler.Bind("inproc://" + zapEndpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		frames, err := handler.RecvMultipart()
+		if err != nil {
+			return
+		}
+		req, err := zmtp.DecodeZAPRequest(frames)
+		if err != nil {
+			return
+		}
+		reply, _ := (&zmtp.ZAPReply{
+			RequestID:  req.RequestID,
+			StatusCode: zmtp.ZAPStatusOK,
+			UserID:     req.Domain + "-user",
+		}).Encode()
+		handler.SendMultipart(reply)
+	}()
+
+	router := NewRouter(zmtp.NewSecurityNull())
+	router.SetZAPDomain("global")
+	defer router.Close()
+
+	addr, err = router.Bind("tcp://127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := NewReq(zmtp.NewSecurityNull())
+	defer req.Close()
+
+	err = req.Connect("tcp://" + addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = req.Send([]byte("HELLO"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frames, err := router.RecvMultipart()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := router.GetConnection(string(frames[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	userID, _ := conn.Metadata("User-Id")
+	if want, got := "global-user", userID; want != got {
+		t.Fatalf("want user id %q, got %q", want, got)
+	}
+}
+
+func TestZAPForgedUserID(t *testing.T) {
+	router := NewRouter(zmtp.NewSecurityNull())
+	router.SetZAPHandler(func(req *zmtp.ZAPRequest) *zmtp.ZAPReply {
+		return &zmtp.ZAPReply{RequestID: req.RequestID, StatusCode: zmtp.ZAPStatusOK}
+	})
+	defer router.Close()
+
+	addr, err := router.Bind("tcp://127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := NewReq(forgingMechanism{
+		SecurityMechanism: zmtp.NewSecurityNull(),
+		properties:        map[string]string{"User-Id": "admin"},
+	})
+	defer req.Close()
+
+	err = req.Connect("tcp://" + addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = req.Send([]byte("HELLO"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := router.RecvMultipart()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := router.GetConnection(string(msg[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if userID, ok := conn.Metadata("User-Id"); ok {
+		t.Fatalf("want no user id, got %q", userID)
+	}
+}
+
+func TestInprocZAPHandlerErrors(t *testing.T) {
+	defer func(timeout time.Duration) { zapTimeout = timeout }(zapTimeout)
+	zapTimeout = 200 * time.Millisecond
+
+	handler := NewRep(zmtp.NewSecurityNull())
+	defer handler.Close()
+
+	_, err := handler.Bind("inproc://" + zapEndpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		// reply to another request, then never reply
+		if _, err := handler.RecvMultipart(); err != nil {
+			return
+		}
+		reply, _ := (&zmtp.ZAPReply{RequestID: "other", StatusCode: zmtp.ZAPStatusOK}).Encode()
+		handler.SendMultipart(reply)
+		handler.RecvMultipart()
+	}()
+
+	req := &zmtp.ZAPRequest{RequestID: "1", Domain: "test", Mechanism: zmtp.NullSecurityMechanismType}
+	for _, name := range []string{"mismatched request id", "timeout"} {
+		reply := inprocZAPHandler(req)
+		if want, got := zmtp.ZAPStatusInternalError, reply.StatusCode; want != got {
+			t.Fatalf("%s: want status %q, got %q (%s)", name, want, got, reply.StatusText)
+		}
+		if want, got := req.RequestID, reply.RequestID; want != got {
+			t.Fatalf("%s: want request id %q, got %q", name, want, got)
+		}
+	}
+}
+
+func TestZMTP20(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	// a libzmq 3.x PUB socket, speaking ZMTP 2.0
+	subscriptions := make(chan string, 2)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+
+				// signature, revision, PUB socket type and empty identity
+				greeting := []byte{0xff, 0, 0, 0, 0, 0, 0, 0, 1, 0x7f, 0x01, 0x01, 0x00, 0x00}
+				if _, err := conn.Write(greeting); err != nil {
+					return
+				}
+				if _, err := io.ReadFull(conn, make([]byte, len(greeting))); err != nil {
+					return
+				}
+
+				var header [2]byte
+				if _, err := io.ReadFull(conn, header[:]); err != nil {
+					return
+				}
+				subscription := make([]byte, header[1])
+				if _, err := io.ReadFull(conn, subscription); err != nil {
+					return
+				}
+				subscriptions <- string(subscription)
+
+				msg := "A-HELLO"
+				conn.Write(append([]byte{0x00, byte(len(msg))}, msg...))
+				io.Copy(ioutil.Discard, conn)
+			}()
+		}
+	}()
+
+	sub := NewSub(zmtp.NewSecurityNull())
+	defer sub.Close()
+
+	if err := sub.Connect("tcp://" + ln.Addr().String()); err == nil {
+		t.Fatal("connecting to a ZMTP 2.0 peer MUST raise error unless allowed")
+	}
+
+	sub.SetZMTP20Allowed(true)
+	if err := sub.Connect("tcp://" + ln.Addr().String()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sub.Subscribe([]byte("A")); err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := "\x01A", <-subscriptions; want != got {
+		t.Fatalf("want subscription %q, got %q", want, got)
+	}
+
+	msg, err := sub.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := "A-HELLO", string(msg); want != got {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	pull := NewPull(zmtp.NewSecurityNull())
+	pull.SetHeartbeatIvl(10 * time.Millisecond)
+	pull.SetHeartbeatTTL(time.Second)
+	defer pull.Close()
+
+	addr, err := pull.Bind("tcp://127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	push := NewPush(zmtp.NewSecurityNull())
+	push.SetHeartbeatIvl(10 * time.Millisecond)
+	defer push.Close()
+
+	err = push.Connect("tcp://" + addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// PINGs are answered, PONGs are not passed on
+	time.Sleep(100 * time.Millisecond)
+
+	err = push.Send([]byte("HELLO"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := pull.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := "HELLO", string(msg); want != got {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+
+	// a peer which does not answer PINGs
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	accepted := make(chan struct{}, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			go func(conn net.Conn) {
+				defer conn.Close()
+
+				zmtpConn := zmtp.NewConnection(conn)
+				if _, err := zmtpConn.Prepare(zmtp.NewSecurityNull(), zmtp.PushSocketType, nil, true, nil); err != nil {
+					return
+				}
+				select {
+				case accepted <- struct{}{}:
+				default:
+				}
+				io.Copy(ioutil.Discard, conn)
+			}(conn)
+		}
+	}()
+
+	dead := NewPull(zmtp.NewSecurityNull())
+	dead.SetHeartbeatIvl(10 * time.Millisecond)
+	dead.SetHeartbeatTimeout(30 * time.Millisecond)
+	defer dead.Close()
+
+	err = dead.Connect("tcp://" + ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the dead connection is closed, and the endpoint connected again
+	for i := 0; i < 2; i++ {
+		select {
+		case <-accepted:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("want the socket to reconnect, got %v connections", i)
+		}
 	}
 }
@@ -0,0 +1,91 @@
+package gomq
+
+import (
+	"errors"
+	"net"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// StreamSocket is a ZMQ_STREAM socket type. It talks
+// to raw TCP peers, without any ZMTP handshake nor
+// framing. Messages are made of the routing id of the
+// peer followed by the data. A message with empty data
+// is received when a peer connects or disconnects.
+type StreamSocket struct {
+	*Socket
+}
+
+// NewStream returns a StreamSocket.
+func NewStream() *StreamSocket {
+	return &StreamSocket{
+		Socket: NewSocket(false, zmtp.StreamSocketType, nil, zmtp.NewSecurityNull()),
+	}
+}
+
+// Bind accepts a zeromq endpoint and binds the
+// stream socket to it. The endpoint string should be in
+// the format "<proto>://<address>", e.g.
+// "tcp://<address>:<port>" or "ipc://<path>".
+func (s *StreamSocket) Bind(endpoint string) (net.Addr, error) {
+	return BindServer(s, endpoint)
+}
+
+// Connect accepts a zeromq endpoint and connects the
+// stream socket to it. The endpoint string should be in
+// the format "<proto>://<address>", e.g.
+// "tcp://<address>:<port>" or "ipc://<path>".
+func (s *StreamSocket) Connect(endpoint string) error {
+	return ConnectClient(s, endpoint)
+}
+
+// Recv is not supported by stream sockets, as the
+// routing id of the peer would be lost. Use RecvMultipart.
+func (s *StreamSocket) Recv() ([]byte, error) {
+	return nil, errors.New("gomq: stream sockets only support RecvMultipart")
+}
+
+// Send is not supported by stream sockets, as data
+// needs a routing id. Use SendMultipart.
+func (s *StreamSocket) Send(b []byte) error {
+	return errors.New("gomq: stream sockets only support SendMultipart")
+}
+
+// RecvMultipart receives data from any peer, as a
+// [routing id, data] message.
+func (s *StreamSocket) RecvMultipart() ([][]byte, error) {
+	for {
+		msg := <-s.recvChannel
+		if msg.Err != nil {
+			// the disconnection was already notified.
+			continue
+		}
+		return [][]byte{[]byte(msg.RoutingID), msg.Body[0]}, nil
+	}
+}
+
+// SendMultipart sends data, given as a [routing id, data]
+// message, to the peer with that routing id. Sending empty
+// data closes the connection to the peer.
+func (s *StreamSocket) SendMultipart(b [][]byte) error {
+	if len(b) != 2 {
+		return errors.New("gomq: stream messages must be made of a routing id and data")
+	}
+
+	id := string(b[0])
+	conn, err := s.GetConnection(id)
+	if err != nil {
+		return err
+	}
+
+	if len(b[1]) == 0 {
+		s.RemoveConnection(id)
+		return nil
+	}
+	return conn.zmtp.SendFrame(b[1])
+}
+
+var (
+	_ Client = (*StreamSocket)(nil)
+	_ Server = (*StreamSocket)(nil)
+)
@@ -0,0 +1,148 @@
+package gomq
+
+import (
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// SubSocket is a ZMQ_SUB socket type.
+// See: https://rfc.zeromq.org/spec:29
+type SubSocket struct {
+	*Socket
+
+	subsLock *sync.Mutex
+	subs     subscriptions
+}
+
+// NewSub accepts a zmtp.SecurityMechanism and returns
+// a SubSocket.
+func NewSub(mechanism zmtp.SecurityMechanism) *SubSocket {
+	return newSubSocket(zmtp.SubSocketType, mechanism)
+}
+
+func newSubSocket(sockType zmtp.SocketType, mechanism zmtp.SecurityMechanism) *SubSocket {
+	return &SubSocket{
+		Socket:   NewSocket(false, sockType, nil, mechanism),
+		subsLock: &sync.Mutex{},
+		subs:     make(subscriptions),
+	}
+}
+
+// Bind accepts a zeromq endpoint and binds the
+// sub socket to it. The endpoint string should be in
+// the format "<proto>://<address>", e.g.
+// "tcp://<address>:<port>" or "ipc://<path>".
+func (s *SubSocket) Bind(endpoint string) (net.Addr, error) {
+	return BindServer(s, endpoint)
+}
+
+// Connect accepts a zeromq endpoint and connects the
+// sub socket to it. The endpoint string should be in
+// the format "<proto>://<address>", e.g.
+// "tcp://<address>:<port>" or "ipc://<path>".
+func (s *SubSocket) Connect(endpoint string) error {
+	return ConnectClient(s, endpoint)
+}
+
+// AddConnection adds a gomq.Connection to the socket
+// and sends it the current subscriptions. As with PUB
+// sockets, a peer which cannot be sent the subscriptions
+// is closed and removed.
+func (s *SubSocket) AddConnection(conn *Connection) {
+	s.subsLock.Lock()
+	defer s.subsLock.Unlock()
+
+	s.Socket.AddConnection(conn)
+	for prefix := range s.subs {
+		if err := conn.zmtp.SendCommand("SUBSCRIBE", []byte(prefix)); err != nil {
+			s.Socket.RemoveConnection(conn.id)
+			return
+		}
+	}
+}
+
+// Subscribe subscribes to the messages whose first
+// frame starts with prefix. An empty prefix subscribes
+// to all messages.
+func (s *SubSocket) Subscribe(prefix []byte) error {
+	s.subsLock.Lock()
+	defer s.subsLock.Unlock()
+
+	if !s.subs.add(prefix) {
+		return nil
+	}
+	return s.sendCommand("SUBSCRIBE", prefix)
+}
+
+// Unsubscribe removes a subscription previously
+// added with Subscribe.
+func (s *SubSocket) Unsubscribe(prefix []byte) error {
+	s.subsLock.Lock()
+	defer s.subsLock.Unlock()
+
+	if !s.subs.remove(prefix) {
+		return nil
+	}
+	return s.sendCommand("CANCEL", prefix)
+}
+
+// sendCommand sends a command to all the peers.
+func (s *SubSocket) sendCommand(name string, body []byte) error {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	for _, conn := range s.conns {
+		if err := conn.zmtp.SendCommand(name, body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Send is not supported by sub sockets.
+func (s *SubSocket) Send(b []byte) error {
+	return errors.New("gomq: sub sockets cannot send messages")
+}
+
+// SendMultipart is not supported by sub sockets.
+func (s *SubSocket) SendMultipart(b [][]byte) error {
+	return errors.New("gomq: sub sockets cannot send messages")
+}
+
+// Recv receives a message and returns its first frame.
+func (s *SubSocket) Recv() ([]byte, error) {
+	msg, err := s.RecvMultipart()
+	if err != nil {
+		return nil, err
+	}
+	return msg[0], nil
+}
+
+// RecvMultipart receives a message matching one
+// of the subscriptions.
+func (s *SubSocket) RecvMultipart() ([][]byte, error) {
+	for {
+		msg := <-s.recvChannel
+		if msg.Err != nil {
+			return nil, msg.Err
+		}
+		if msg.MessageType != zmtp.UserMessage || len(msg.Body) == 0 {
+			continue
+		}
+
+		s.subsLock.Lock()
+		match := s.subs.match(msg.Body[0])
+		s.subsLock.Unlock()
+		if match {
+			return msg.Body, nil
+		}
+	}
+}
+
+var (
+	_ Client = (*SubSocket)(nil)
+	_ Server = (*SubSocket)(nil)
+)
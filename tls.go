@@ -0,0 +1,75 @@
+package gomq
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+)
+
+// tlsTransport is the transport for tls:// endpoints,
+// carrying ZMTP over TLS. It is configured with the
+// TLS config of the socket, see Socket.SetTLSConfig.
+type tlsTransport struct {
+	config *tls.Config
+}
+
+func (t tlsTransport) Dial(address string) (net.Conn, error) {
+	config := &tls.Config{}
+	if t.config != nil {
+		config = t.config.Clone()
+	}
+	if config.ServerName == "" {
+		config.ServerName, _, _ = net.SplitHostPort(address)
+	}
+	return tls.Dial("tcp", address, config)
+}
+
+func (t tlsTransport) Listen(address string) (net.Listener, error) {
+	if t.config == nil || (len(t.config.Certificates) == 0 && t.config.GetCertificate == nil) {
+		return nil, errors.New("gomq: listening on a tls endpoint needs a tls.Config with a certificate")
+	}
+	return tls.Listen("tcp", address, t.config)
+}
+
+func (t tlsTransport) withTLSConfig(config *tls.Config) Transport {
+	return tlsTransport{config: config}
+}
+
+// tlsConfigurable is implemented by the transports
+// using the TLS config of the socket, if it has one.
+type tlsConfigurable interface {
+	withTLSConfig(config *tls.Config) Transport
+}
+
+// socketTransport returns the transport used by s for the
+// endpoints of the given scheme, configured with the TLS
+// config of s.
+func socketTransport(s ZeroMQSocket, scheme string) (Transport, error) {
+	t, err := lookupTransport(scheme)
+	if err != nil {
+		return nil, err
+	}
+
+	tc, ok := t.(tlsConfigurable)
+	if !ok {
+		return t, nil
+	}
+	if c, ok := s.(interface{ TLSConfig() *tls.Config }); ok && c.TLSConfig() != nil {
+		return tc.withTLSConfig(c.TLSConfig()), nil
+	}
+	return t, nil
+}
+
+// tlsMetadata returns the metadata of a TLS connection,
+// once the TLS handshake is done: the subject of the peer
+// certificate, if the peer presented one, as "Peer-Subject".
+func tlsMetadata(conn *tls.Conn) map[string]string {
+	if err := conn.Handshake(); err != nil {
+		return nil
+	}
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return nil
+	}
+	return map[string]string{"Peer-Subject": certs[0].Subject.String()}
+}
@@ -0,0 +1,71 @@
+package gomq
+
+import (
+	"crypto/tls"
+	"net"
+	"sync"
+)
+
+// Transport is a gomq transport, used to dial and listen
+// on the addresses of the endpoints of a given scheme.
+// The connections it returns carry the ZMTP protocol.
+type Transport interface {
+	Dial(address string) (net.Conn, error)
+	Listen(address string) (net.Listener, error)
+}
+
+var transports = struct {
+	sync.RWMutex
+	schemes map[string]Transport
+}{
+	schemes: make(map[string]Transport),
+}
+
+// RegisterTransport registers the transport used for the
+// endpoints of the given scheme, e.g. "tcp" for endpoints
+// such as "tcp://127.0.0.1:5555". It replaces the transport
+// previously registered for that scheme, if any. The inproc
+// scheme is built in and cannot be registered.
+// If t is nil or scheme is "inproc", it panics.
+func RegisterTransport(scheme string, t Transport) {
+	if t == nil {
+		panic("gomq: RegisterTransport transport is nil")
+	}
+	if scheme == "inproc" {
+		panic("gomq: RegisterTransport cannot register the inproc scheme")
+	}
+
+	transports.Lock()
+	transports.schemes[scheme] = t
+	transports.Unlock()
+}
+
+// lookupTransport returns the transport registered for scheme.
+func lookupTransport(scheme string) (Transport, error) {
+	transports.RLock()
+	defer transports.RUnlock()
+	t, ok := transports.schemes[scheme]
+	if !ok {
+		return nil, ErrBadProto(scheme)
+	}
+	return t, nil
+}
+
+// tcpTransport is the transport for tcp:// endpoints.
+type tcpTransport struct{}
+
+func (tcpTransport) Dial(address string) (net.Conn, error) {
+	return net.Dial("tcp", address)
+}
+
+func (tcpTransport) Listen(address string) (net.Listener, error) {
+	return net.Listen("tcp", address)
+}
+
+func init() {
+	RegisterTransport("tcp", tcpTransport{})
+	RegisterTransport("ipc", ipcTransport{})
+	RegisterTransport("tls", tlsTransport{})
+	RegisterTransport("ws", NewWebSocketTransport(nil))
+	RegisterTransport("wss", NewWebSocketTransport(&tls.Config{}))
+}
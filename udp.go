@@ -0,0 +1,104 @@
+package gomq
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// maxDatagramSize is the maximum size of a RADIO/DISH
+// datagram, as in libzmq.
+const maxDatagramSize = 8192
+
+// encodeDatagram encodes a RADIO/DISH message as a udp
+// datagram, following the libzmq wire format: the length
+// of the group on one octet, the group, then the body.
+func encodeDatagram(group string, body []byte) ([]byte, error) {
+	if err := checkGroup(group); err != nil {
+		return nil, err
+	}
+	size := 1 + len(group) + len(body)
+	if size > maxDatagramSize {
+		return nil, fmt.Errorf("gomq: udp datagram of %d bytes is larger than %d bytes", size, maxDatagramSize)
+	}
+
+	b := make([]byte, 0, size)
+	b = append(b, byte(len(group)))
+	b = append(b, group...)
+	return append(b, body...), nil
+}
+
+// decodeDatagram decodes a udp datagram encoded by encodeDatagram.
+func decodeDatagram(b []byte) (string, []byte, error) {
+	if len(b) == 0 || int(b[0]) > len(b)-1 {
+		return "", nil, errors.New("gomq: malformed udp datagram")
+	}
+	n := int(b[0])
+	return string(b[1 : 1+n]), b[1+n:], nil
+}
+
+// resolveUDPAddr resolves the address of an udp endpoint,
+// where "*" stands for all the interfaces.
+func resolveUDPAddr(address string) (*net.UDPAddr, error) {
+	if strings.HasPrefix(address, "*:") {
+		address = address[1:]
+	}
+	return net.ResolveUDPAddr("udp", address)
+}
+
+// dialUDP returns a connection sending datagrams to the
+// unicast or multicast address of an udp endpoint.
+func dialUDP(address string) (*net.UDPConn, error) {
+	addr, err := resolveUDPAddr(address)
+	if err != nil {
+		return nil, err
+	}
+	return net.DialUDP("udp", nil, addr)
+}
+
+// listenUDP returns a connection receiving the datagrams
+// sent to the address of an udp endpoint. The multicast
+// group is joined for multicast addresses.
+func listenUDP(address string) (*net.UDPConn, error) {
+	addr, err := resolveUDPAddr(address)
+	if err != nil {
+		return nil, err
+	}
+	if addr.IP.IsMulticast() {
+		return net.ListenMulticastUDP("udp", nil, addr)
+	}
+	return net.ListenUDP("udp", addr)
+}
+
+// serveUDP forwards the datagrams received on conn to the
+// receive channel of s, until conn is closed. Malformed
+// datagrams are dropped.
+func serveUDP(s ZeroMQSocket, conn *net.UDPConn) {
+	buf := make([]byte, maxDatagramSize)
+	for {
+		n, addr, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			// reads which timed out are retried, the loop
+			// stops once conn is closed or on other errors
+			var ne net.Error
+			if !errors.Is(err, net.ErrClosed) && errors.As(err, &ne) && ne.Timeout() {
+				continue
+			}
+			return
+		}
+
+		group, body, err := decodeDatagram(buf[:n])
+		if err != nil {
+			continue
+		}
+		s.RecvChannel() <- &zmtp.Message{
+			Body:        [][]byte{append([]byte(nil), body...)},
+			MessageType: zmtp.UserMessage,
+			RoutingID:   addr.String(),
+			Group:       group,
+		}
+	}
+}
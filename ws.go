@@ -0,0 +1,468 @@
+package gomq
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// wsProtocols returns the WebSocket subprotocols of ZWS/2.0 for
+// the security mechanism m. "ZWS2.0" alone stands for the NULL
+// mechanism.
+func wsProtocols(m zmtp.SecurityMechanismType) []string {
+	if m == zmtp.NullSecurityMechanismType {
+		return []string{"ZWS2.0/NULL", "ZWS2.0"}
+	}
+	return []string{"ZWS2.0/" + string(m)}
+}
+
+// wsMechanism returns the security mechanism of the ZWS/2.0
+// subprotocol protocol.
+func wsMechanism(protocol string) (zmtp.SecurityMechanismType, bool) {
+	if protocol == "ZWS2.0" {
+		return zmtp.NullSecurityMechanismType, true
+	}
+	if !strings.HasPrefix(protocol, "ZWS2.0/") {
+		return "", false
+	}
+	return zmtp.SecurityMechanismType(protocol[len("ZWS2.0/"):]), true
+}
+
+// wsGUID is used to compute the Sec-WebSocket-Accept header.
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// wsMaxMessageSize is the maximum size of a received WebSocket message.
+const wsMaxMessageSize = 64 << 20
+
+const (
+	wsOpContinuation = 0x0
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xa
+)
+
+// WebSocketTransport is the transport for ws:// and wss://
+// endpoints, in the format <scheme>://<address>:<port>/<path>.
+// ZMTP frames are carried in binary WebSocket messages,
+// following the ZWS/2.0 mapping.
+// See: https://rfc.zeromq.org/spec:45
+type WebSocketTransport struct {
+	config *tls.Config
+}
+
+// NewWebSocketTransport returns a WebSocketTransport. If config
+// is not nil, connections are secured with TLS (wss://). Listening
+// on a wss:// endpoint requires config to hold a certificate.
+func NewWebSocketTransport(config *tls.Config) *WebSocketTransport {
+	return &WebSocketTransport{config: config}
+}
+
+// withTLSConfig returns a wss:// transport using config.
+// ws:// transports are left as is.
+func (t *WebSocketTransport) withTLSConfig(config *tls.Config) Transport {
+	if t.config == nil {
+		return t
+	}
+	return NewWebSocketTransport(config)
+}
+
+// splitWebSocketAddress splits the address of a WebSocket
+// endpoint into its host:port and path parts.
+func splitWebSocketAddress(address string) (string, string) {
+	i := strings.Index(address, "/")
+	if i < 0 {
+		return address, "/"
+	}
+	return address[:i], address[i:]
+}
+
+// Dial connects to the WebSocket endpoint at address. The
+// WebSocket handshake happens on the first read or write.
+func (t *WebSocketTransport) Dial(address string) (net.Conn, error) {
+	host, path := splitWebSocketAddress(address)
+
+	var (
+		conn net.Conn
+		err  error
+	)
+	if t.config != nil {
+		config := t.config.Clone()
+		if config.ServerName == "" {
+			config.ServerName, _, _ = net.SplitHostPort(host)
+		}
+		conn, err = tls.Dial("tcp", host, config)
+	} else {
+		conn, err = net.Dial("tcp", host)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ws := newWSConn(conn, true)
+	ws.handshake = func() error { return ws.clientHandshake(host, path) }
+	return ws, nil
+}
+
+// Listen listens on the WebSocket endpoint at address.
+func (t *WebSocketTransport) Listen(address string) (net.Listener, error) {
+	host, path := splitWebSocketAddress(address)
+
+	var (
+		ln  net.Listener
+		err error
+	)
+	if t.config != nil {
+		if len(t.config.Certificates) == 0 && t.config.GetCertificate == nil {
+			return nil, errors.New("gomq: listening on a wss endpoint needs a tls.Config with a certificate")
+		}
+		ln, err = tls.Listen("tcp", host, t.config)
+	} else {
+		ln, err = net.Listen("tcp", host)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &wsListener{Listener: ln, path: path}, nil
+}
+
+// wsListener accepts WebSocket connections for a given path.
+type wsListener struct {
+	net.Listener
+	path string
+}
+
+// Accept accepts a connection. The WebSocket handshake
+// happens on the first read or write.
+func (l *wsListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	ws := newWSConn(conn, false)
+	ws.handshake = func() error { return ws.serverHandshake(l.path) }
+	return ws, nil
+}
+
+// wsConn is a WebSocket connection. It implements net.Conn,
+// each Write being sent as a binary message, as well as
+// zmtp.MessageReadWriter.
+type wsConn struct {
+	net.Conn
+	br        *bufio.Reader
+	isClient  bool
+	mechanism zmtp.SecurityMechanismType // set before the handshake
+	protocol  string                     // the negotiated subprotocol
+
+	handshake     func() error
+	handshakeOnce sync.Once
+	handshakeErr  error
+
+	rlock sync.Mutex
+	rbuf  []byte // data left over by Read
+	wlock sync.Mutex
+}
+
+func newWSConn(conn net.Conn, isClient bool) *wsConn {
+	return &wsConn{
+		Conn:      conn,
+		br:        bufio.NewReader(conn),
+		isClient:  isClient,
+		mechanism: zmtp.NullSecurityMechanismType,
+	}
+}
+
+// Mechanism returns the security mechanism agreed on with
+// the other end through the WebSocket subprotocol.
+func (c *wsConn) Mechanism() (zmtp.SecurityMechanismType, error) {
+	if err := c.doHandshake(); err != nil {
+		return "", err
+	}
+	m, _ := wsMechanism(c.protocol)
+	return m, nil
+}
+
+func (c *wsConn) doHandshake() error {
+	c.handshakeOnce.Do(func() {
+		c.handshakeErr = c.handshake()
+	})
+	return c.handshakeErr
+}
+
+func wsAccept(key string) string {
+	h := sha1.New()
+	io.WriteString(h, key+wsGUID)
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func (c *wsConn) clientHandshake(host, path string) error {
+	var nonce [16]byte
+	if _, err := io.ReadFull(rand.Reader, nonce[:]); err != nil {
+		return err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce[:])
+
+	req, err := http.NewRequest("GET", "http://"+host+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	offered := wsProtocols(c.mechanism)
+	req.Header.Set("Sec-WebSocket-Protocol", strings.Join(offered, ", "))
+	if err := req.Write(c.Conn); err != nil {
+		return err
+	}
+
+	resp, err := http.ReadResponse(c.br, req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return fmt.Errorf("gomq: websocket handshake failed with status %q", resp.Status)
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != wsAccept(key) {
+		return errors.New("gomq: websocket handshake failed, bad Sec-WebSocket-Accept")
+	}
+	protocol := resp.Header.Get("Sec-WebSocket-Protocol")
+	for _, p := range offered {
+		if protocol == p {
+			c.protocol = protocol
+			return nil
+		}
+	}
+	return fmt.Errorf("gomq: websocket subprotocol %q was not offered", protocol)
+}
+
+func (c *wsConn) serverHandshake(path string) error {
+	req, err := http.ReadRequest(c.br)
+	if err != nil {
+		return err
+	}
+
+	fail := func(status int, reason string) error {
+		fmt.Fprintf(c.Conn, "HTTP/1.1 %d %s\r\n\r\n", status, http.StatusText(status))
+		return errors.New("gomq: websocket handshake failed, " + reason)
+	}
+
+	if req.URL.Path != path {
+		return fail(http.StatusNotFound, "unknown path "+req.URL.Path)
+	}
+	if req.Method != "GET" ||
+		!strings.EqualFold(req.Header.Get("Upgrade"), "websocket") ||
+		!strings.Contains(strings.ToLower(req.Header.Get("Connection")), "upgrade") ||
+		req.Header.Get("Sec-WebSocket-Version") != "13" ||
+		req.Header.Get("Sec-WebSocket-Key") == "" {
+		return fail(http.StatusBadRequest, "not a websocket upgrade request")
+	}
+
+	for _, offered := range strings.Split(req.Header.Get("Sec-WebSocket-Protocol"), ",") {
+		offered = strings.TrimSpace(offered)
+		if m, ok := wsMechanism(offered); ok && m == c.mechanism {
+			c.protocol = offered
+			break
+		}
+	}
+	if c.protocol == "" {
+		return fail(http.StatusBadRequest, "no ZWS2.0 subprotocol offered for the "+string(c.mechanism)+" mechanism")
+	}
+
+	_, err = fmt.Fprintf(c.Conn, "HTTP/1.1 101 Switching Protocols\r\n"+
+		"Upgrade: websocket\r\n"+
+		"Connection: Upgrade\r\n"+
+		"Sec-WebSocket-Accept: %s\r\n"+
+		"Sec-WebSocket-Protocol: %s\r\n\r\n",
+		wsAccept(req.Header.Get("Sec-WebSocket-Key")), c.protocol)
+	return err
+}
+
+// writeFrame writes a single, unfragmented, WebSocket frame.
+// Frames sent by clients are masked.
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	c.wlock.Lock()
+	defer c.wlock.Unlock()
+
+	header := make([]byte, 2, 14)
+	header[0] = 0x80 | opcode // FIN
+	switch n := len(payload); {
+	case n < 126:
+		header[1] = byte(n)
+	case n <= 0xffff:
+		header[1] = 126
+		header = append(header, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(n))
+	default:
+		header[1] = 127
+		header = append(header, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(n))
+	}
+
+	if c.isClient {
+		var mask [4]byte
+		if _, err := io.ReadFull(rand.Reader, mask[:]); err != nil {
+			return err
+		}
+		header[1] |= 0x80
+		header = append(header, mask[:]...)
+
+		masked := make([]byte, len(payload))
+		for i, b := range payload {
+			masked[i] = b ^ mask[i%4]
+		}
+		payload = masked
+	}
+
+	if _, err := c.Conn.Write(header); err != nil {
+		return err
+	}
+	_, err := c.Conn.Write(payload)
+	return err
+}
+
+// readFrame reads a single WebSocket frame.
+func (c *wsConn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.br, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	fin = header[0]&0x80 != 0
+	opcode = header[0] & 0x0f
+	masked := header[1]&0x80 != 0
+
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var buf [2]byte
+		if _, err := io.ReadFull(c.br, buf[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(buf[:]))
+	case 127:
+		var buf [8]byte
+		if _, err := io.ReadFull(c.br, buf[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(buf[:])
+	}
+	if length > wsMaxMessageSize {
+		return false, 0, nil, fmt.Errorf("gomq: websocket frame of %d bytes is too large", length)
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return fin, opcode, payload, nil
+}
+
+// ReadMessage reads the next binary message, answering
+// the control frames received meanwhile.
+func (c *wsConn) ReadMessage() ([]byte, error) {
+	if err := c.doHandshake(); err != nil {
+		return nil, err
+	}
+
+	var msg []byte
+	started := false
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+
+		switch opcode {
+		case wsOpPing:
+			if err := c.writeFrame(wsOpPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case wsOpPong:
+			continue
+		case wsOpClose:
+			c.writeFrame(wsOpClose, nil)
+			return nil, io.EOF
+		case wsOpBinary:
+			if started {
+				return nil, errors.New("gomq: websocket message interrupted by another one")
+			}
+			started = true
+		case wsOpContinuation:
+			if !started {
+				return nil, errors.New("gomq: websocket continuation frame without a message")
+			}
+		default:
+			return nil, fmt.Errorf("gomq: unexpected websocket opcode %#x", opcode)
+		}
+
+		msg = append(msg, payload...)
+		if len(msg) > wsMaxMessageSize {
+			return nil, fmt.Errorf("gomq: websocket message of %d bytes is too large", len(msg))
+		}
+		if fin {
+			return msg, nil
+		}
+	}
+}
+
+// WriteMessage writes b as a binary message.
+func (c *wsConn) WriteMessage(b []byte) error {
+	if err := c.doHandshake(); err != nil {
+		return err
+	}
+	return c.writeFrame(wsOpBinary, b)
+}
+
+// Read reads the data of the binary messages as a stream.
+func (c *wsConn) Read(b []byte) (int, error) {
+	c.rlock.Lock()
+	defer c.rlock.Unlock()
+
+	for len(c.rbuf) == 0 {
+		msg, err := c.ReadMessage()
+		if err != nil {
+			return 0, err
+		}
+		c.rbuf = msg
+	}
+	n := copy(b, c.rbuf)
+	c.rbuf = c.rbuf[n:]
+	return n, nil
+}
+
+// Write writes b as a binary message.
+func (c *wsConn) Write(b []byte) (int, error) {
+	if err := c.WriteMessage(b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
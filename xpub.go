@@ -0,0 +1,152 @@
+package gomq
+
+import (
+	"net"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// XPubSocket is a ZMQ_XPUB socket type. It behaves
+// like a PubSocket, except that the subscriptions of
+// the peers are received as messages: a subscription
+// is a single frame made of a 0x01 byte followed by
+// the prefix, a cancellation uses a 0x00 byte instead.
+// Only the first subscription to and the last cancellation
+// of a prefix, over all peers, are received.
+//
+// Subscriptions are queued until they are received, in
+// order, so that peers are not blocked by an application
+// which does not receive them.
+// See: https://rfc.zeromq.org/spec:29
+type XPubSocket struct {
+	*PubSocket
+
+	all        subscriptions   // number of peers subscribed to a prefix
+	queue      []*zmtp.Message // subscriptions not received yet
+	delivering bool            // a goroutine is delivering the queue
+}
+
+// NewXPub accepts a zmtp.SecurityMechanism and returns
+// a XPubSocket.
+func NewXPub(mechanism zmtp.SecurityMechanism) *XPubSocket {
+	return &XPubSocket{
+		PubSocket: newPubSocket(zmtp.XPubSocketType, mechanism),
+		all:       make(subscriptions),
+	}
+}
+
+// Bind accepts a zeromq endpoint and binds the
+// xpub socket to it. The endpoint string should be in
+// the format "<proto>://<address>", e.g.
+// "tcp://<address>:<port>" or "ipc://<path>".
+func (x *XPubSocket) Bind(endpoint string) (net.Addr, error) {
+	return BindServer(x, endpoint)
+}
+
+// Connect accepts a zeromq endpoint and connects the
+// xpub socket to it. The endpoint string should be in
+// the format "<proto>://<address>", e.g.
+// "tcp://<address>:<port>" or "ipc://<path>".
+func (x *XPubSocket) Connect(endpoint string) error {
+	return ConnectClient(x, endpoint)
+}
+
+// RemoveConnection removes the connection with the
+// given routing id, along with its subscriptions.
+func (x *XPubSocket) RemoveConnection(uuid string) {
+	x.Socket.RemoveConnection(uuid)
+
+	x.subsLock.Lock()
+	defer x.subsLock.Unlock()
+	for prefix := range x.subs[uuid] {
+		if x.all.remove([]byte(prefix)) {
+			x.enqueue(subscriptionMessage(uuid, false, []byte(prefix)))
+		}
+	}
+	delete(x.subs, uuid)
+}
+
+// Recv receives a message and returns its first frame.
+func (x *XPubSocket) Recv() ([]byte, error) {
+	return x.Socket.Recv()
+}
+
+// RecvMultipart receives a message. It is either a
+// subscription or a message sent by a peer.
+func (x *XPubSocket) RecvMultipart() ([][]byte, error) {
+	return x.Socket.RecvMultipart()
+}
+
+// handleCommand keeps track of the SUBSCRIBE and CANCEL
+// commands sent by the peers and passes them on to the
+// application.
+func (x *XPubSocket) handleCommand(conn *Connection, name string, body []byte) {
+	x.subsLock.Lock()
+	defer x.subsLock.Unlock()
+
+	var changed, subscribe bool
+	switch name {
+	case "SUBSCRIBE":
+		if x.subs[conn.id] == nil {
+			x.subs[conn.id] = make(subscriptions)
+		}
+		changed = x.subs[conn.id].add(body) && x.all.add(body)
+		subscribe = true
+	case "CANCEL":
+		changed = x.subs[conn.id].remove(body) && x.all.remove(body)
+	}
+
+	if changed {
+		x.enqueue(subscriptionMessage(conn.id, subscribe, body))
+	}
+}
+
+// enqueue queues a subscription message until it is received.
+// It must be called with x.subsLock held.
+func (x *XPubSocket) enqueue(msg *zmtp.Message) {
+	x.queue = append(x.queue, msg)
+	if !x.delivering {
+		x.delivering = true
+		go x.deliver()
+	}
+}
+
+// deliver passes the queued subscription messages on to the
+// application, until the queue is empty.
+func (x *XPubSocket) deliver() {
+	for {
+		x.subsLock.Lock()
+		if len(x.queue) == 0 {
+			x.delivering = false
+			x.subsLock.Unlock()
+			return
+		}
+		msg := x.queue[0]
+		x.queue = x.queue[1:]
+		x.subsLock.Unlock()
+
+		x.recvChannel <- msg
+	}
+}
+
+// subscriptionMessage returns the message passed on to
+// the application for a subscription or a cancellation.
+func subscriptionMessage(routingID string, subscribe bool, prefix []byte) *zmtp.Message {
+	var flag byte
+	if subscribe {
+		flag = 1
+	}
+	body := make([]byte, 0, len(prefix)+1)
+	body = append(body, flag)
+	body = append(body, prefix...)
+	return &zmtp.Message{
+		Body:        [][]byte{body},
+		MessageType: zmtp.UserMessage,
+		RoutingID:   routingID,
+	}
+}
+
+var (
+	_ Client = (*XPubSocket)(nil)
+	_ Server = (*XPubSocket)(nil)
+)
@@ -0,0 +1,88 @@
+package gomq
+
+import (
+	"net"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// XSubSocket is a ZMQ_XSUB socket type. It behaves
+// like a SubSocket, except that subscriptions are
+// sent as messages: a single frame made of a 0x01
+// byte followed by the prefix subscribes to it, a
+// 0x00 byte cancels the subscription. Other messages
+// are sent to all the peers, and received messages
+// are not filtered.
+// See: https://rfc.zeromq.org/spec:29
+type XSubSocket struct {
+	*SubSocket
+}
+
+// NewXSub accepts a zmtp.SecurityMechanism and returns
+// a XSubSocket.
+func NewXSub(mechanism zmtp.SecurityMechanism) *XSubSocket {
+	return &XSubSocket{
+		SubSocket: newSubSocket(zmtp.XSubSocketType, mechanism),
+	}
+}
+
+// Bind accepts a zeromq endpoint and binds the
+// xsub socket to it. The endpoint string should be in
+// the format "<proto>://<address>", e.g.
+// "tcp://<address>:<port>" or "ipc://<path>".
+func (x *XSubSocket) Bind(endpoint string) (net.Addr, error) {
+	return BindServer(x, endpoint)
+}
+
+// Connect accepts a zeromq endpoint and connects the
+// xsub socket to it. The endpoint string should be in
+// the format "<proto>://<address>", e.g.
+// "tcp://<address>:<port>" or "ipc://<path>".
+func (x *XSubSocket) Connect(endpoint string) error {
+	return ConnectClient(x, endpoint)
+}
+
+// Send sends a single frame message.
+func (x *XSubSocket) Send(b []byte) error {
+	return x.SendMultipart([][]byte{b})
+}
+
+// SendMultipart sends a message. Subscription messages
+// are counted as Subscribe and Unsubscribe do: a SUBSCRIBE
+// command is only sent for the first subscription to a
+// prefix, and a CANCEL command once all of them are
+// cancelled. Other messages are sent to all the peers.
+func (x *XSubSocket) SendMultipart(b [][]byte) error {
+	if len(b) == 1 && len(b[0]) > 0 {
+		switch b[0][0] {
+		case 1:
+			return x.Subscribe(b[0][1:])
+		case 0:
+			return x.Unsubscribe(b[0][1:])
+		}
+	}
+
+	x.lock.RLock()
+	defer x.lock.RUnlock()
+	for _, conn := range x.conns {
+		if err := conn.zmtp.SendMultipart(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Recv receives a message and returns its first frame.
+func (x *XSubSocket) Recv() ([]byte, error) {
+	return x.Socket.Recv()
+}
+
+// RecvMultipart receives a message.
+func (x *XSubSocket) RecvMultipart() ([][]byte, error) {
+	return x.Socket.RecvMultipart()
+}
+
+var (
+	_ Client = (*XSubSocket)(nil)
+	_ Server = (*XSubSocket)(nil)
+)
@@ -0,0 +1,134 @@
+package gomq
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/zeromq/gomq/zmtp"
+)
+
+// zapEndpoint is the name of the inproc endpoint
+// ZAP handlers bind to.
+const zapEndpoint = "zeromq.zap.01"
+
+// zapTimeout is how long the ZAP handler bound to the
+// inproc endpoint has to reply to a request.
+var zapTimeout = 10 * time.Second
+
+// SetZAPDomain sets the ZAP domain of the socket, sent to
+// its ZAP handler. With the NULL mechanism, peers are only
+// authenticated by the handler bound to inproc://zeromq.zap.01
+// if a domain is set. It must be called before Bind or Connect.
+func (s *Socket) SetZAPDomain(domain string) {
+	s.zapDomain = domain
+}
+
+// SetZAPHandler sets the ZAP handler asked to allow or deny
+// the peers connecting to the socket. Without a handler, the
+// ZAP handler bound to inproc://zeromq.zap.01, if any, is used.
+// It must be called before Bind or Connect.
+// See: https://rfc.zeromq.org/spec:27
+func (s *Socket) SetZAPHandler(handler zmtp.ZAPHandler) {
+	s.zapHandler = handler
+}
+
+// zap returns the ZAP handler and domain used by the socket,
+// or a nil handler if peers are not authenticated.
+func (s *Socket) zap() (zmtp.ZAPHandler, string) {
+	if s.zapHandler != nil {
+		return s.zapHandler, s.zapDomain
+	}
+	if s.zapDomain == "" && s.mechanism.Type() == zmtp.NullSecurityMechanismType {
+		return nil, ""
+	}
+
+	inprocEndpoints.Lock()
+	_, ok := inprocEndpoints.servers[zapEndpoint]
+	inprocEndpoints.Unlock()
+	if !ok {
+		return nil, ""
+	}
+	return inprocZAPHandler, s.zapDomain
+}
+
+// zapAddress returns the address of a peer, as sent
+// in ZAP requests: the IP address of tcp peers.
+func zapAddress(netConn net.Conn) string {
+	if netConn == nil || netConn.RemoteAddr() == nil {
+		return ""
+	}
+	addr := netConn.RemoteAddr().String()
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// inprocZAPHandler sends req to the ZAP handler bound to
+// inproc://zeromq.zap.01, as a REQ socket would, and returns
+// its reply. Replies to other requests, or coming after
+// zapTimeout, are answered with an internal error.
+func inprocZAPHandler(req *zmtp.ZAPRequest) *zmtp.ZAPReply {
+	reply, err := requestInprocZAP(req)
+	if err != nil {
+		return &zmtp.ZAPReply{
+			RequestID:  req.RequestID,
+			StatusCode: zmtp.ZAPStatusInternalError,
+			StatusText: err.Error(),
+		}
+	}
+	return reply
+}
+
+func requestInprocZAP(req *zmtp.ZAPRequest) (*zmtp.ZAPReply, error) {
+	conn, err := dialInproc(zapEndpoint)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	_, err = conn.Prepare(zmtp.NewSecurityNull(), zmtp.ReqSocketType, nil, false, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// REQ messages start with an empty delimiter
+	err = conn.SendMultipart(append([][]byte{{}}, req.Encode()...))
+	if err != nil {
+		return nil, err
+	}
+
+	msgs := make(chan *zmtp.Message, 3)
+	conn.RecvMultipart(msgs)
+	timeout := time.After(zapTimeout)
+	for {
+		var msg *zmtp.Message
+		select {
+		case msg = <-msgs:
+		case <-timeout:
+			return nil, errors.New("gomq: ZAP handler did not reply in time")
+		}
+
+		if msg.Err != nil {
+			return nil, msg.Err
+		}
+		if msg.MessageType != zmtp.UserMessage {
+			continue
+		}
+
+		frames := msg.Body
+		if len(frames) > 0 && len(frames[0]) == 0 {
+			frames = frames[1:]
+		}
+		reply, err := zmtp.DecodeZAPReply(frames)
+		if err != nil {
+			return nil, err
+		}
+		if reply.RequestID != req.RequestID {
+			return nil, fmt.Errorf("gomq: ZAP reply to request %q, want %q", reply.RequestID, req.RequestID)
+		}
+		return reply, nil
+	}
+}
@@ -1,20 +1,29 @@
 package zmtp
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
 	"io"
 	"strings"
+	"sync"
 )
 
 // Connection is a ZMTP level connection
 type Connection struct {
 	rw                         io.ReadWriter
+	wlock                      sync.Mutex // serializes the writes of frames
 	metadata                   map[string]string
 	securityMechanism          SecurityMechanism
 	socket                     Socket
 	isPrepared                 bool
+	version                    [2]uint8          // ZMTP version negotiated with the other end
+	codec                      Codec             // set by the security handshake, if any
+	zap                        *zap              // ZAP handler of servers, if any
+	allowZMTP20                bool              // whether ZMTP 2.0 peers are allowed
+	heartbeat                  *heartbeat        // PINGs sent and deadlines, if any
+	isRaw                      bool              // no ZMTP framing, used by STREAM sockets
+	pipe                       *pipe             // in-memory transport, used by inproc
+	messages                   MessageReadWriter // message-oriented transport, e.g. WebSocket
 	asServer, otherEndAsServer bool
 }
 
@@ -35,18 +44,26 @@ func (id SocketIdentity) String() string {
 }
 
 const (
-	ClientSocketType SocketType = "CLIENT" // a ZMQ_CLIENT socket
-	ServerSocketType SocketType = "SERVER" // a ZMQ_SERVER socket
-	PullSocketType   SocketType = "PULL"   // a ZMQ_PULL socket
-	PushSocketType   SocketType = "PUSH"   // a ZMQ_PUSH socket
-	DealerSocketType SocketType = "DEALER" // a ZMQ_DEALER socket
-	RouterSocketType SocketType = "ROUTER" // a ZMQ_ROUTER socket
-	ReqSocketType    SocketType = "REQ"    // a ZMQ_REQ socket
-	RepSocketType    SocketType = "REP"    // a ZMQ_REP socket
-	PubSocketType    SocketType = "PUB"    // a ZMQ_PUB socket
-	SubSocketType    SocketType = "SUB"    // a ZMQ_SUB socket
-	XPubSocketType   SocketType = "XPUB"   // a ZMQ_XPUB socket
-	XSubSocketType   SocketType = "XSUB"   // a ZMQ_XSUB socket
+	ClientSocketType  SocketType = "CLIENT"  // a ZMQ_CLIENT socket
+	ServerSocketType  SocketType = "SERVER"  // a ZMQ_SERVER socket
+	PullSocketType    SocketType = "PULL"    // a ZMQ_PULL socket
+	PushSocketType    SocketType = "PUSH"    // a ZMQ_PUSH socket
+	DealerSocketType  SocketType = "DEALER"  // a ZMQ_DEALER socket
+	RouterSocketType  SocketType = "ROUTER"  // a ZMQ_ROUTER socket
+	ReqSocketType     SocketType = "REQ"     // a ZMQ_REQ socket
+	RepSocketType     SocketType = "REP"     // a ZMQ_REP socket
+	PubSocketType     SocketType = "PUB"     // a ZMQ_PUB socket
+	SubSocketType     SocketType = "SUB"     // a ZMQ_SUB socket
+	XPubSocketType    SocketType = "XPUB"    // a ZMQ_XPUB socket
+	XSubSocketType    SocketType = "XSUB"    // a ZMQ_XSUB socket
+	RadioSocketType   SocketType = "RADIO"   // a ZMQ_RADIO socket
+	DishSocketType    SocketType = "DISH"    // a ZMQ_DISH socket
+	ScatterSocketType SocketType = "SCATTER" // a ZMQ_SCATTER socket
+	GatherSocketType  SocketType = "GATHER"  // a ZMQ_GATHER socket
+	PairSocketType    SocketType = "PAIR"    // a ZMQ_PAIR socket
+	PeerSocketType    SocketType = "PEER"    // a ZMQ_PEER socket
+	ChannelSocketType SocketType = "CHANNEL" // a ZMQ_CHANNEL socket
+	StreamSocketType  SocketType = "STREAM"  // a ZMQ_STREAM socket
 )
 
 // NewConnection accepts an io.ReadWriter and creates a new ZMTP connection
@@ -65,139 +82,294 @@ func (c *Connection) Prepare(mechanism SecurityMechanism, socketType SocketType,
 
 	c.isPrepared = true
 	c.securityMechanism = mechanism
+	c.asServer = asServer
 
 	var err error
 	if c.socket, err = NewSocket(socketType); err != nil {
 		return nil, fmt.Errorf("gomq/zmtp: Got error while creating socket: %v", err)
 	}
 
-	// Send/recv greeting
-	if err := c.sendGreeting(asServer); err != nil {
-		return nil, fmt.Errorf("gomq/zmtp: Got error while sending greeting: %v", err)
+	// STREAM sockets talk to raw TCP peers, there is no handshake
+	if socketType == StreamSocketType {
+		if c.pipe != nil {
+			return nil, errors.New("gomq/zmtp: STREAM sockets cannot be used over a pipe")
+		}
+		c.isRaw = true
+		return nil, nil
 	}
-	if err := c.recvGreeting(asServer); err != nil {
-		return nil, fmt.Errorf("gomq/zmtp: Got error while receiving greeting: %v", err)
+
+	metadata, err := c.localMetadata(socketType, socketID, applicationMetadata)
+	if err != nil {
+		return nil, fmt.Errorf("gomq/zmtp: Got error while sending metadata: %v", err)
 	}
 
-	// Do security handshake
-	if err := mechanism.Handshake(); err != nil {
-		return nil, fmt.Errorf("gomq/zmtp: Got error while running the security handshake: %v", err)
+	// Pipes stay within the process, only metadata is exchanged
+	if c.pipe != nil {
+		mechanism = NewSecurityNull()
 	}
 
-	// Send/recv metadata
-	if err := c.sendMetadata(socketType, socketID, applicationMetadata); err != nil {
-		return nil, fmt.Errorf("gomq/zmtp: Got error while sending metadata: %v", err)
+	// Message-oriented transports have no greeting, the
+	// mechanism is the one they agreed on with the other end
+	c.version = version
+	peer := Greeting{Version: version, Mechanism: mechanism.Type(), AsServer: !asServer}
+	if c.messages != nil {
+		otherMechanism, err := c.messages.Mechanism()
+		if err != nil {
+			return nil, fmt.Errorf("gomq/zmtp: Got error while agreeing on the security mechanism: %v", err)
+		}
+		if otherMechanism != mechanism.Type() {
+			return nil, fmt.Errorf("gomq/zmtp: Got error while agreeing on the security mechanism: Encryption mechanism on other side %q does not match this side's %q", otherMechanism, mechanism.Type())
+		}
+	}
+	if c.pipe == nil && c.messages == nil {
+		// Send/recv greeting, up to the major version first
+		// to detect ZMTP 2.0 peers
+		var local, other [greetingLength]byte
+		local = c.localGreeting(asServer)
+		if err := c.sendGreeting(local[:greetingPrefixLength]); err != nil {
+			return nil, fmt.Errorf("gomq/zmtp: Got error while sending greeting: %v", err)
+		}
+		if err := c.recvGreeting(other[:greetingPrefixLength]); err != nil {
+			return nil, fmt.Errorf("gomq/zmtp: Got error while receiving greeting: %v", err)
+		}
+		if err := checkSignature(other[:greetingPrefixLength]); err != nil {
+			return nil, fmt.Errorf("gomq/zmtp: Got error while receiving greeting: %v", err)
+		}
+
+		if other[10] < majorVersion {
+			if err := c.prepareZMTP20(other[10], socketID); err != nil {
+				return nil, fmt.Errorf("gomq/zmtp: Got error while talking to a ZMTP 2.0 peer: %v", err)
+			}
+			return make(map[string]string), nil
+		}
+
+		if err := c.sendGreeting(local[greetingPrefixLength:]); err != nil {
+			return nil, fmt.Errorf("gomq/zmtp: Got error while sending greeting: %v", err)
+		}
+		if err := c.recvGreeting(other[greetingPrefixLength:]); err != nil {
+			return nil, fmt.Errorf("gomq/zmtp: Got error while receiving greeting: %v", err)
+		}
+		if peer, err = c.parseGreeting(other); err != nil {
+			return nil, fmt.Errorf("gomq/zmtp: Got error while receiving greeting: %v", err)
+		}
 	}
 
-	otherEndApplicationMetaData, err := c.recvMetadata()
+	// Servers ask their ZAP handler, if any, to authenticate the other end
+	var rw CommandReadWriter = handshakeCommands{c}
+	if c.zap != nil && asServer && c.pipe == nil {
+		c.zap.identity = socketID.String()
+		rw = zapCommands{handshakeCommands{c}}
+	}
+
+	// Do security handshake, exchanging metadata
+	peerMetadata, codec, err := mechanism.Handshake(rw, asServer, peer, metadata)
 	if err != nil {
-		return nil, fmt.Errorf("gomq/zmtp: Got error while receiving metadata: %v", err)
+		return nil, fmt.Errorf("gomq/zmtp: Got error while running the security handshake: %v", err)
+	}
+
+	// Properties set by the transport cannot be overridden
+	// by the other end
+	otherEndApplicationMetaData := make(map[string]string)
+	for k, v := range peerMetadata {
+		k = strings.ToLower(k)
+		if strings.HasPrefix(k, "x-") {
+			otherEndApplicationMetaData[k[2:]] = v
+		} else if _, ok := c.metadata[k]; !ok {
+			c.metadata[k] = v
+		}
 	}
 
+	otherSocketType := SocketType(c.metadata["socket-type"])
+	if !c.socket.IsSocketTypeCompatible(otherSocketType) {
+		return nil, fmt.Errorf("gomq/zmtp: Got error while receiving metadata: Socket type %v is not compatible with %v", c.socket.Type(), otherSocketType)
+	}
+
+	c.codec = codec
+
+	// Only ZMTP 3.1 has heartbeats, pipes need none
+	if c.pipe == nil && c.version == version {
+		c.startHeartbeat()
+	}
 	return otherEndApplicationMetaData, nil
 }
 
-func (c *Connection) sendGreeting(asServer bool) error {
+// localMetadata returns the metadata sent to the other end
+func (c *Connection) localMetadata(socketType SocketType, socketID SocketIdentity, applicationMetadata map[string]string) (Metadata, error) {
+	metadata := make(Metadata)
+
+	for k, v := range applicationMetadata {
+		if len(k) == 0 {
+			return nil, errors.New("Cannot send empty application metadata key")
+		}
+
+		lowerCaseKey := strings.ToLower(k)
+		if _, alreadyPresent := metadata["x-"+lowerCaseKey]; alreadyPresent {
+			return nil, fmt.Errorf("Key %q is specified multiple times with different casing", lowerCaseKey)
+		}
+
+		metadata["x-"+lowerCaseKey] = v
+	}
+
+	metadata["Socket-Type"] = string(socketType)
+	metadata["Identity"] = socketID.String()
+
+	return metadata, nil
+}
+
+// localGreeting returns the greeting sent to the other end
+func (c *Connection) localGreeting(asServer bool) [greetingLength]byte {
 	greeting := greeting{
 		SignaturePrefix: signaturePrefix,
 		SignatureSuffix: signatureSuffix,
 		Version:         version,
+		ServerFlag:      toByteBool(asServer),
 	}
 	toNullPaddedString(string(c.securityMechanism.Type()), greeting.Mechanism[:])
-
-	if err := greeting.marshal(c.rw); err != nil {
-		return err
-	}
-
-	return nil
+	return greeting.encode()
 }
 
-func (c *Connection) recvGreeting(asServer bool) error {
-	var greeting greeting
+// sendGreeting sends part of the greeting
+func (c *Connection) sendGreeting(part []byte) error {
+	_, err := c.rw.Write(part)
+	return err
+}
 
-	if err := greeting.unmarshal(c.rw); err != nil {
+// recvGreeting reads part of the greeting of the other end
+func (c *Connection) recvGreeting(part []byte) error {
+	if _, err := io.ReadFull(c.rw, part); err != nil {
 		return fmt.Errorf("Error while reading: %v", err)
 	}
+	return nil
+}
 
-	if greeting.SignaturePrefix != signaturePrefix {
-		return fmt.Errorf("Signature prefix received does not correspond with expected signature. Received: %#v. Expected: %#v.", greeting.SignaturePrefix, signaturePrefix)
+// checkSignature checks the signature at the start of the
+// greeting of the other end
+func checkSignature(prefix []byte) error {
+	if prefix[0] != signaturePrefix {
+		return fmt.Errorf("Signature prefix received does not correspond with expected signature. Received: %#v. Expected: %#v.", prefix[0], signaturePrefix)
 	}
 
-	if greeting.SignatureSuffix != signatureSuffix {
-		return fmt.Errorf("Signature prefix received does not correspond with expected signature. Received: %#v. Expected: %#v.", greeting.SignatureSuffix, signatureSuffix)
+	if prefix[9] != signatureSuffix {
+		return fmt.Errorf("Signature prefix received does not correspond with expected signature. Received: %#v. Expected: %#v.", prefix[9], signatureSuffix)
 	}
+	return nil
+}
+
+// parseGreeting checks the ZMTP 3.x greeting of the other end.
+// Other ends with a higher version downgrade to ours, and we
+// downgrade to theirs if it is ZMTP 3.0.
+func (c *Connection) parseGreeting(buf [greetingLength]byte) (Greeting, error) {
+	var greeting greeting
+	greeting.decode(buf)
 
-	if greeting.Version != version {
-		return fmt.Errorf("Version %v.%v received does match expected version %v.%v", int(greeting.Version[0]), int(greeting.Version[1]), int(majorVersion), int(minorVersion))
+	if greeting.Version == version30 {
+		c.version = version30
 	}
 
 	var otherMechanism = fromNullPaddedString(greeting.Mechanism[:])
 	var thisMechanism = string(c.securityMechanism.Type())
 	if thisMechanism != otherMechanism {
-		return fmt.Errorf("Encryption mechanism on other side %q does not match this side's %q", otherMechanism, thisMechanism)
+		return Greeting{}, fmt.Errorf("Encryption mechanism on other side %q does not match this side's %q", otherMechanism, thisMechanism)
 	}
 
 	otherEndAsServer, err := fromByteBool(greeting.ServerFlag)
 	if err != nil {
-		return err
+		return Greeting{}, err
 	}
 	c.otherEndAsServer = otherEndAsServer
 
-	return nil
+	return Greeting{
+		Version:   greeting.Version,
+		Mechanism: SecurityMechanismType(otherMechanism),
+		AsServer:  otherEndAsServer,
+	}, nil
 }
 
-func (c *Connection) sendMetadata(socketType SocketType, socketID SocketIdentity, applicationMetadata map[string]string) error {
-	buffer := new(bytes.Buffer)
-	var usedKeys map[string]struct{}
+// SetZMTP20Allowed sets whether the connection may talk to
+// ZMTP 2.0 peers, e.g. libzmq 3.x, which are refused otherwise.
+// ZMTP 2.0 has no security mechanism, only connections using
+// NULL without a ZAP handler can talk to them. It must be
+// called before Prepare.
+func (c *Connection) SetZMTP20Allowed(allowed bool) {
+	c.allowZMTP20 = allowed
+}
 
-	for k, v := range applicationMetadata {
-		if len(k) == 0 {
-			return errors.New("Cannot send empty application metadata key")
-		}
+// prepareZMTP20 finishes the handshake with a ZMTP 2.0 peer,
+// whose revision was read instead of a major version: the
+// socket types and the identities are exchanged, instead of
+// the rest of the greeting and the metadata.
+// See: https://rfc.zeromq.org/spec:15
+func (c *Connection) prepareZMTP20(revision byte, socketID SocketIdentity) error {
+	if revision != zmtp20Revision {
+		return fmt.Errorf("Revision %v received is not supported", int(revision))
+	}
+	if !c.allowZMTP20 {
+		return errors.New("ZMTP 2.0 peers are not allowed")
+	}
+	if c.securityMechanism.Type() != NullSecurityMechanismType {
+		return fmt.Errorf("Security mechanism %v is not supported by ZMTP 2.0", c.securityMechanism.Type())
+	}
+	if c.zap != nil && c.asServer {
+		return errors.New("ZMTP 2.0 peers cannot be authenticated by a ZAP handler")
+	}
 
-		lowerCaseKey := strings.ToLower(k)
-		if _, alreadyPresent := usedKeys[lowerCaseKey]; alreadyPresent {
-			return fmt.Errorf("Key %q is specified multiple times with different casing", lowerCaseKey)
-		}
+	socketType, ok := zmtp20SocketTypes[c.socket.Type()]
+	if !ok {
+		return fmt.Errorf("Socket type %v is not supported by ZMTP 2.0", c.socket.Type())
+	}
 
-		usedKeys[lowerCaseKey] = struct{}{}
-		c.writeMetadata(buffer, "x-"+lowerCaseKey, v)
+	// Socket type, then the identity in a final short frame
+	identity := socketID.String()
+	buf := append([]byte{socketType, 0, byte(len(identity))}, identity...)
+	if err := c.sendGreeting(buf); err != nil {
+		return err
 	}
 
-	c.writeMetadata(buffer, "socket-type", string(socketType))
-	c.writeMetadata(buffer, "Identity", socketID.String())
+	var header [3]byte
+	if err := c.recvGreeting(header[:]); err != nil {
+		return err
+	}
+	if header[1] != 0 {
+		return fmt.Errorf("Identity frame flags %#v received are not the ones of a final short frame", header[1])
+	}
+	otherIdentity := make([]byte, header[2])
+	if err := c.recvGreeting(otherIdentity); err != nil {
+		return err
+	}
 
-	return c.SendCommand("READY", buffer.Bytes())
+	var otherSocketType SocketType
+	for t, b := range zmtp20SocketTypes {
+		if b == header[0] {
+			otherSocketType = t
+		}
+	}
+	if !c.socket.IsSocketTypeCompatible(otherSocketType) {
+		return fmt.Errorf("Socket type %v is not compatible with %v", c.socket.Type(), otherSocketType)
+	}
+
+	c.metadata["socket-type"] = string(otherSocketType)
+	c.metadata["identity"] = string(otherIdentity)
+	c.version = version20
+	return nil
 }
 
-func (c *Connection) writeMetadata(buffer *bytes.Buffer, name string, value string) {
-	var (
-		p        = 0
-		nameLen  = len(name)
-		valueLen = len(value)
-		buf      = make([]byte, 1+nameLen+4+valueLen)
-	)
-	buf[p] = byte(nameLen)
-	p++
-	p += copy(buf[p:], name)
-	byteOrder.PutUint32(buf[p:p+4], uint32(valueLen))
-	p += 4
-	copy(buf[p:], value)
-
-	_, err := buffer.Write(buf)
-	if err != nil {
-		panic(err)
-	}
+// hasSubscriptionMessages reports whether subscriptions are
+// sent as messages instead of commands, as ZMTP 2.0 and 3.0
+// peers expect.
+func (c *Connection) hasSubscriptionMessages() bool {
+	return c.version == version20 || c.version == version30
 }
 
-func (c *Connection) recvMetadata() (map[string]string, error) {
+// recvCommand reads a command during the handshake. An ERROR
+// command sent by the other end is returned as an error.
+func (c *Connection) recvCommand() (*Command, error) {
 	isCommand, body, err := c.read()
 	if err != nil {
 		return nil, err
 	}
 
 	if !isCommand {
-		return nil, errors.New("Got a message frame for metadata, expected a command frame")
+		return nil, errors.New("Got a message frame during the handshake, expected a command frame")
 	}
 
 	command, err := c.parseCommand(body)
@@ -205,54 +377,65 @@ func (c *Connection) recvMetadata() (map[string]string, error) {
 		return nil, err
 	}
 
-	if command.Name != "READY" {
-		return nil, fmt.Errorf("Got a %v command for metadata instead of the expected READY command frame", command.Name)
-	}
-
-	applicationMetadata := make(map[string]string)
-	i := 0
-	for i < len(command.Body) {
-		// Key length
-		keyLength := int(command.Body[i])
-		if i+keyLength >= len(command.Body) {
-			return nil, fmt.Errorf("metadata key of length %v overflows body of length %v at position %v", keyLength, len(command.Body), i)
+	if command.Name == "ERROR" {
+		reason := command.Body
+		if len(reason) > 0 && int(reason[0]) <= len(reason)-1 {
+			reason = reason[1 : 1+int(reason[0])]
 		}
-		i++
+		return nil, fmt.Errorf("Got an ERROR command from the other end: %s", reason)
+	}
+	return command, nil
+}
 
-		// Key
-		key := strings.ToLower(string(command.Body[i : i+keyLength]))
-		i += keyLength
+// handshakeCommands gives the security mechanism access
+// to the commands of a connection during the handshake
+type handshakeCommands struct {
+	c *Connection
+}
 
-		// Value length
-		rawValueLength := byteOrder.Uint32(command.Body[i : i+4])
+func (h handshakeCommands) ReadCommand() (*Command, error) {
+	return h.c.recvCommand()
+}
 
-		if uint64(rawValueLength) > uint64(maxInt) {
-			return nil, fmt.Errorf("Length of value %v overflows integer max length %v on this platform", rawValueLength, maxInt)
-		}
+func (h handshakeCommands) WriteCommand(name string, body []byte) error {
+	return h.c.SendCommand(name, body)
+}
 
-		valueLength := int(rawValueLength)
-		if i+valueLength >= len(command.Body) {
-			return nil, fmt.Errorf("metadata value of length %v overflows body of length %v at position %v", valueLength, len(command.Body), i)
-		}
-		i += 4
+// Metadata returns the value of a metadata property of the connection.
+// Property names are case-insensitive.
+func (c *Connection) Metadata(name string) (string, bool) {
+	value, ok := c.metadata[strings.ToLower(name)]
+	return value, ok
+}
 
-		// Value
-		value := string(command.Body[i : i+valueLength])
-		i += valueLength
+// SetMetadata sets a metadata property of the connection, such as a
+// property of the underlying transport. It must be called before the
+// connection is used.
+func (c *Connection) SetMetadata(name, value string) {
+	c.metadata[strings.ToLower(name)] = value
+}
 
-		if strings.HasPrefix(key, "x-") {
-			applicationMetadata[key[2:]] = value
-		} else {
-			c.metadata[key] = value
-		}
+// Close closes the connection, and its underlying ReadWriter
+// if it is an io.Closer.
+func (c *Connection) Close() error {
+	c.stopHeartbeat()
+	if c.pipe != nil {
+		return c.pipe.close()
 	}
-
-	socketType := c.metadata["socket-type"]
-	if !c.socket.IsSocketTypeCompatible(SocketType(socketType)) {
-		return nil, fmt.Errorf("Socket type %v is not compatible with %v", c.socket.Type(), socketType)
+	if closer, ok := c.messages.(io.Closer); ok {
+		return closer.Close()
+	}
+	if closer, ok := c.rw.(io.Closer); ok {
+		return closer.Close()
 	}
+	return nil
+}
 
-	return applicationMetadata, nil
+// Version returns the ZMTP version negotiated with the other
+// end once the connection is prepared, e.g. [2]uint8{3, 0} for
+// ZMTP 3.0 peers.
+func (c *Connection) Version() [2]uint8 {
+	return c.version
 }
 
 // GetIdentity get connection's identity
@@ -270,6 +453,11 @@ func (c *Connection) SendCommand(commandName string, body []byte) error {
 		return errors.New("Command names may not be longer than 255 characters")
 	}
 
+	// ZMTP 2.0 and 3.0 peers expect subscriptions as messages
+	if c.hasSubscriptionMessages() && isSubscriptionCommand(commandName) {
+		return c.send(false, subscriptionMessage(commandName, body))
+	}
+
 	bodyLen := len(body)
 
 	buf := make([]byte, 1+cmdLen+bodyLen) // FIXME(sbinet): maybe use a pool of []byte ?
@@ -286,12 +474,42 @@ func (c *Connection) SendFrame(body []byte) error {
 }
 
 func (c *Connection) send(isCommand bool, body []byte) error {
+	c.wlock.Lock()
+	defer c.wlock.Unlock()
+
+	if c.pipe != nil {
+		return c.pipe.write(isCommand, [][]byte{body})
+	}
+
+	if c.isRaw {
+		return c.sendRaw(isCommand, body)
+	}
+
+	// More flag: Unused, we don't support multiframe messages
+	return c.writeFrame(isCommand, false, body)
+}
+
+// writeFrame writes out a single frame, encrypted by the
+// security mechanism once the handshake is done
+func (c *Connection) writeFrame(isCommand, hasMore bool, body []byte) error {
+	isCommand, hasMore, body, err := c.sealFrame(isCommand, hasMore, body)
+	if err != nil {
+		return err
+	}
+
+	if c.messages != nil {
+		return c.writeMessageFrame(isCommand, hasMore, body)
+	}
+
 	// Compute total body length
 	length := len(body)
 
 	var bitFlags byte
 
-	// More flag: Unused, we don't support multiframe messages
+	// More flag
+	if hasMore {
+		bitFlags ^= hasMoreBitFlag
+	}
 
 	// Long flag
 	isLong := length > 255
@@ -311,35 +529,62 @@ func (c *Connection) send(isCommand bool, body []byte) error {
 
 	if isLong {
 		var buf [8]byte
-		byteOrder.PutUint64(buf[:], uint64(len(body)))
+		byteOrder.PutUint64(buf[:], uint64(length))
 		if _, err := c.rw.Write(buf[:]); err != nil {
 			return err
 		}
 	} else {
-		if _, err := c.rw.Write([]byte{uint8(len(body))}); err != nil {
+		if _, err := c.rw.Write([]byte{uint8(length)}); err != nil {
 			return err
 		}
 	}
 
-	if _, err := c.rw.Write(c.securityMechanism.Encrypt(body)); err != nil {
+	if _, err := c.rw.Write(body); err != nil {
 		return err
 	}
 
 	return nil
 }
 
+// sealFrame returns the flags and the body of a frame as sent on
+// the wire, once encoded by the codec of the security mechanism
+func (c *Connection) sealFrame(isCommand, hasMore bool, body []byte) (bool, bool, []byte, error) {
+	if c.codec == nil {
+		return isCommand, hasMore, body, nil
+	}
+	frame, err := c.codec.Encode(Frame{IsCommand: isCommand, HasMore: hasMore, Body: body})
+	return frame.IsCommand, frame.HasMore, frame.Body, err
+}
+
+// openFrame is the reverse of sealFrame
+func (c *Connection) openFrame(isCommand, hasMore bool, body []byte) (bool, bool, []byte, error) {
+	if c.codec == nil {
+		return isCommand, hasMore, body, nil
+	}
+	frame, err := c.codec.Decode(Frame{IsCommand: isCommand, HasMore: hasMore, Body: body})
+	return frame.IsCommand, frame.HasMore, frame.Body, err
+}
+
 // Recv starts listening to the ReadWriter and passes *Message to a channel
 func (c *Connection) Recv(messageOut chan<- *Message) {
+	if c.isRaw {
+		go c.recvRaw(messageOut)
+		return
+	}
+
 	go func() {
 		for {
 			// Actually read out the body and send it over the channel now
 			isCommand, body, err := c.read()
 			if err != nil {
-				messageOut <- &Message{Err: err, MessageType: ErrorMessage}
+				messageOut <- &Message{Err: c.heartbeatError(err), MessageType: ErrorMessage}
 				return
 			}
 
-			if !isCommand {
+			if command := c.subscriptionCommand([][]byte{body}); !isCommand && command != nil {
+				frames := [][]byte{command.Body}
+				messageOut <- &Message{Name: command.Name, Body: frames, MessageType: ErrorMessage}
+			} else if !isCommand {
 				// Data frame
 				frames := [][]byte{body}
 				messageOut <- &Message{Body: frames, MessageType: UserMessage}
@@ -354,11 +599,13 @@ func (c *Connection) Recv(messageOut chan<- *Message) {
 				// Certain commands we deal with directly, the rest we send over to the application
 				switch command.Name {
 				case "PING":
-					// When we get a ping, we want to send back a pong, we don't really care about the contents right now
-					if err := c.SendCommand("PONG", nil); err != nil {
+					// Answer with a PONG echoing the context of the PING
+					if err := c.handlePing(command.Body); err != nil {
 						messageOut <- &Message{Err: err, MessageType: ErrorMessage}
 						return
 					}
+				case "PONG":
+					// The deadlines were cleared when it was read
 				default:
 					frames := [][]byte{command.Body}
 					messageOut <- &Message{Name: command.Name, Body: frames, MessageType: ErrorMessage}
@@ -371,13 +618,49 @@ func (c *Connection) Recv(messageOut chan<- *Message) {
 
 // read returns the isCommand flag, the body of the message, and optionally an error
 func (c *Connection) read() (bool, []byte, error) {
+	if c.pipe != nil {
+		isCommand, frames, err := c.pipe.read()
+		if err != nil {
+			return false, nil, err
+		}
+		if len(frames) != 1 {
+			return false, nil, errors.New("Received a packet with the MORE flag set to true, we don't support more")
+		}
+		return isCommand, frames[0], nil
+	}
+
+	isCommand, hasMore, body, err := c.readFrame()
+	if err != nil {
+		return false, nil, err
+	}
+
+	// Error out in case get a more flag set to true
+	if hasMore {
+		return false, nil, errors.New("Received a packet with the MORE flag set to true, we don't support more")
+	}
+
+	return isCommand, body, nil
+}
+
+// readFrame reads a single frame, decrypted by the security
+// mechanism once the handshake is done
+func (c *Connection) readFrame() (bool, bool, []byte, error) {
+	if c.messages != nil {
+		isCommand, hasMore, body, err := c.readMessageFrame()
+		if err != nil {
+			return false, false, nil, err
+		}
+		c.heartbeatReceived()
+		return c.openFrame(isCommand, hasMore, body)
+	}
+
 	var header [2]byte
 	var longLength [8]byte
 
 	// Read out the header
 	_, err := io.ReadFull(c.rw, header[:])
 	if err != nil {
-		return false, nil, err
+		return false, false, nil, err
 	}
 
 	bitFlags := header[0]
@@ -387,11 +670,6 @@ func (c *Connection) read() (bool, []byte, error) {
 	isLong := bitFlags&isLongBitFlag == isLongBitFlag
 	isCommand := bitFlags&isCommandBitFlag == isCommandBitFlag
 
-	// Error out in case get a more flag set to true
-	if hasMore {
-		return false, nil, errors.New("Received a packet with the MORE flag set to true, we don't support more")
-	}
-
 	// Determine the actual length of the body
 	bodyLength := uint64(0)
 	if isLong {
@@ -402,7 +680,7 @@ func (c *Connection) read() (bool, []byte, error) {
 
 		_, err := io.ReadFull(c.rw, longLength[1:])
 		if err != nil {
-			return false, nil, err
+			return false, false, nil, err
 		}
 
 		bodyLength = byteOrder.Uint64(longLength[:])
@@ -412,15 +690,16 @@ func (c *Connection) read() (bool, []byte, error) {
 	}
 
 	if bodyLength > uint64(maxInt64) {
-		return false, nil, fmt.Errorf("Body length %v overflows max int64 value %v", bodyLength, maxInt64)
+		return false, false, nil, fmt.Errorf("Body length %v overflows max int64 value %v", bodyLength, maxInt64)
 	}
 
 	buf := make([]byte, bodyLength)
 	_, err = io.ReadFull(c.rw, buf)
 	if err != nil {
-		return false, nil, err
+		return false, false, nil, err
 	}
-	return isCommand, buf, nil
+	c.heartbeatReceived()
+	return c.openFrame(isCommand, hasMore, buf)
 }
 
 func (c *Connection) parseCommand(body []byte) (*Command, error) {
@@ -443,52 +722,66 @@ func (c *Connection) parseCommand(body []byte) (*Command, error) {
 	return command, nil
 }
 
-func (c *Connection) SendMultipart(bs [][]byte) error {
-	const cmd = false
-	return c.sendMultipart(cmd, bs)
+// isSubscriptionCommand reports whether name is the name of
+// a command sent by subscribers.
+func isSubscriptionCommand(name string) bool {
+	return name == "SUBSCRIBE" || name == "CANCEL"
 }
 
-func (c *Connection) sendMultipart(isCommand bool, bs [][]byte) error {
-	for i, part := range bs {
-		// Compute total body length
-		length := len(part)
+// subscriptionMessage returns the ZMTP 3.0 message of a
+// SUBSCRIBE or CANCEL command: a byte set to 1 to subscribe
+// and to 0 to cancel, followed by the topic.
+func subscriptionMessage(name string, topic []byte) []byte {
+	msg := make([]byte, 1+len(topic))
+	if name == "SUBSCRIBE" {
+		msg[0] = 1
+	}
+	copy(msg[1:], topic)
+	return msg
+}
 
-		var bitFlags byte
+// subscriptionCommand returns the SUBSCRIBE or CANCEL command
+// of a message sent by a ZMTP 2.0 or 3.0 subscriber, or nil if the
+// message is not a subscription.
+func (c *Connection) subscriptionCommand(frames [][]byte) *Command {
+	if !c.hasSubscriptionMessages() || !c.socket.IsCommandTypeValid("SUBSCRIBE") {
+		return nil
+	}
+	if len(frames) != 1 || len(frames[0]) == 0 || frames[0][0] > 1 {
+		return nil
+	}
 
-		// More flag:
-		if i < len(bs)-1 {
-			bitFlags ^= hasMoreBitFlag
-		}
+	command := &Command{Name: "CANCEL", Body: frames[0][1:]}
+	if frames[0][0] == 1 {
+		command.Name = "SUBSCRIBE"
+	}
+	return command
+}
 
-		// Long flag
-		isLong := length > 255
-		if isLong {
-			bitFlags ^= isLongBitFlag
-		}
+func (c *Connection) SendMultipart(bs [][]byte) error {
+	const cmd = false
+	return c.sendMultipart(cmd, bs)
+}
 
-		// Command flag
-		if isCommand {
-			bitFlags ^= isCommandBitFlag
-		}
+func (c *Connection) sendMultipart(isCommand bool, bs [][]byte) error {
+	c.wlock.Lock()
+	defer c.wlock.Unlock()
 
-		// Write out the message itself
-		if _, err := c.rw.Write([]byte{bitFlags}); err != nil {
-			return err
-		}
+	if c.pipe != nil {
+		return c.pipe.write(isCommand, bs)
+	}
 
-		if isLong {
-			var buf [8]byte
-			byteOrder.PutUint64(buf[:], uint64(len(part)))
-			if _, err := c.rw.Write(buf[:]); err != nil {
-				return err
-			}
-		} else {
-			if _, err := c.rw.Write([]byte{uint8(len(part))}); err != nil {
+	if c.isRaw {
+		for _, part := range bs {
+			if err := c.sendRaw(isCommand, part); err != nil {
 				return err
 			}
 		}
+		return nil
+	}
 
-		if _, err := c.rw.Write(c.securityMechanism.Encrypt(part)); err != nil {
+	for i, part := range bs {
+		if err := c.writeFrame(isCommand, i < len(bs)-1, part); err != nil {
 			return err
 		}
 	}
@@ -497,18 +790,33 @@ func (c *Connection) sendMultipart(isCommand bool, bs [][]byte) error {
 
 // RecvMultipart starts listening to the ReadWriter and passes *Message to a channel
 func (c *Connection) RecvMultipart(messageOut chan<- *Message) {
+	if c.isRaw {
+		go c.recvRaw(messageOut)
+		return
+	}
+
 	go func() {
 		for {
 			// Actually read out the body and send it over the channel now
 			isCommand, body, err := c.readMultipart()
 			if err != nil {
-				messageOut <- &Message{Err: err, MessageType: ErrorMessage}
+				messageOut <- &Message{Err: c.heartbeatError(err), MessageType: ErrorMessage}
 				return
 			}
 
-			if !isCommand {
+			if command := c.subscriptionCommand(body); !isCommand && command != nil {
+				frames := [][]byte{command.Body}
+				messageOut <- &Message{Name: command.Name, Body: frames, MessageType: ErrorMessage}
+			} else if !isCommand {
 				// Data frame
-				messageOut <- &Message{Body: body, MessageType: UserMessage}
+				msg := &Message{Body: body, MessageType: UserMessage}
+				if c.socket.Type() == DishSocketType && len(body) == 2 {
+					// RADIO messages are sent as a group frame
+					// followed by the body frame.
+					msg.Group = string(body[0])
+					msg.Body = body[1:]
+				}
+				messageOut <- msg
 			} else {
 				command, err := c.parseCommand(body[0])
 				if err != nil {
@@ -520,11 +828,13 @@ func (c *Connection) RecvMultipart(messageOut chan<- *Message) {
 				// Certain commands we deal with directly, the rest we send over to the application
 				switch command.Name {
 				case "PING":
-					// When we get a ping, we want to send back a pong, we don't really care about the contents right now
-					if err := c.SendCommand("PONG", nil); err != nil {
+					// Answer with a PONG echoing the context of the PING
+					if err := c.handlePing(command.Body); err != nil {
 						messageOut <- &Message{Err: err, MessageType: ErrorMessage}
 						return
 					}
+				case "PONG":
+					// The deadlines were cleared when it was read
 				default:
 					frames := [][]byte{command.Body}
 					messageOut <- &Message{Name: command.Name, Body: frames, MessageType: ErrorMessage}
@@ -538,58 +848,60 @@ func (c *Connection) RecvMultipart(messageOut chan<- *Message) {
 // readMultipart returns the isCommand flag, the body of the message, and optionally an error
 func (c *Connection) readMultipart() (bool, [][]byte, error) {
 	var (
-		header     [2]byte
-		longLength [8]byte
-		frames     [][]byte
+		frames [][]byte
 
 		hasMore   = true
 		isCommand = false
 	)
 
+	if c.pipe != nil {
+		return c.pipe.read()
+	}
+
 	for hasMore {
-		// Read out the header
-		_, err := io.ReadFull(c.rw, header[:])
+		var (
+			isCommandFrame bool
+			buf            []byte
+			err            error
+		)
+		isCommandFrame, hasMore, buf, err = c.readFrame()
 		if err != nil {
 			return false, nil, err
 		}
+		isCommand = isCommand || isCommandFrame
+		frames = append(frames, buf)
+	}
 
-		bitFlags := header[0]
-
-		// Read all the flags
-		hasMore = bitFlags&hasMoreBitFlag == hasMoreBitFlag
-		isLong := bitFlags&isLongBitFlag == isLongBitFlag
-		isCommand = isCommand || (bitFlags&isCommandBitFlag == isCommandBitFlag)
-
-		// Determine the actual length of the body
-		bodyLength := uint64(0)
-		if isLong {
-			// We read 2 bytes of the header already
-			// In case of a long message, the length is bytes 2-8 of the header
-			// We already have the first byte, so assign it, and then read the rest
-			longLength[0] = header[1]
-
-			_, err := io.ReadFull(c.rw, longLength[1:])
-			if err != nil {
-				return false, nil, err
-			}
+	return isCommand, frames, nil
+}
 
-			bodyLength = byteOrder.Uint64(longLength[:])
-		} else {
-			// Short message length is just 1 byte, read it
-			bodyLength = uint64(header[1])
-		}
+// sendRaw writes body as is, without any ZMTP framing
+func (c *Connection) sendRaw(isCommand bool, body []byte) error {
+	if isCommand {
+		return errors.New("Cannot send a command over a raw connection")
+	}
+	_, err := c.rw.Write(body)
+	return err
+}
 
-		if bodyLength > uint64(maxInt64) {
-			return false, nil, fmt.Errorf("Body length %v overflows max int64 value %v", bodyLength, maxInt64)
+// recvRaw reads whatever data is available from the ReadWriter and passes
+// it to a channel as a single frame *Message. As libzmq does, an empty
+// message is passed when the connection starts and when it ends.
+func (c *Connection) recvRaw(messageOut chan<- *Message) {
+	messageOut <- &Message{Body: [][]byte{{}}, MessageType: UserMessage}
+
+	buf := make([]byte, 8192)
+	for {
+		n, err := c.rw.Read(buf)
+		if n > 0 {
+			frame := make([]byte, n)
+			copy(frame, buf[:n])
+			messageOut <- &Message{Body: [][]byte{frame}, MessageType: UserMessage}
 		}
-
-		buf := make([]byte, bodyLength)
-		_, err = io.ReadFull(c.rw, buf)
 		if err != nil {
-			return false, nil, err
+			messageOut <- &Message{Body: [][]byte{{}}, MessageType: UserMessage}
+			messageOut <- &Message{Err: err, MessageType: ErrorMessage}
+			return
 		}
-		frames = append(frames, buf)
 	}
-
-	return isCommand, frames, nil
 }
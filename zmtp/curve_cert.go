@@ -0,0 +1,407 @@
+package zmtp
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/nacl/box"
+)
+
+// curveCertSecretSuffix is appended to the name of
+// certificate files to get the name of the file
+// holding the secret key.
+const curveCertSecretSuffix = "_secret"
+
+// NewCurveKeypair generates a CURVE long-term keypair.
+func NewCurveKeypair() (publicKey, secretKey [32]byte, err error) {
+	public, secret, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		return publicKey, secretKey, err
+	}
+	return *public, *secret, nil
+}
+
+// EncodeCurveKey returns the 40 characters Z85 text of a key.
+func EncodeCurveKey(key [32]byte) string {
+	s, _ := Z85Encode(key[:])
+	return s
+}
+
+// DecodeCurveKey decodes the 40 characters Z85 text of a key.
+func DecodeCurveKey(s string) ([32]byte, error) {
+	var key [32]byte
+	if len(s) != 40 {
+		return key, fmt.Errorf("CURVE key text must have 40 characters, got %v", len(s))
+	}
+	data, err := Z85Decode(s)
+	if err != nil {
+		return key, err
+	}
+	copy(key[:], data)
+	return key, nil
+}
+
+// CurveCert is a CURVE certificate: a keypair along with
+// metadata, stored in the zcert file format of CZMQ. The
+// secret key of a public certificate is zero.
+type CurveCert struct {
+	PublicKey [32]byte
+	SecretKey [32]byte
+	Metadata  Metadata
+}
+
+// NewCurveCert returns a certificate holding a new keypair.
+func NewCurveCert() (*CurveCert, error) {
+	publicKey, secretKey, err := NewCurveKeypair()
+	if err != nil {
+		return nil, err
+	}
+	return &CurveCert{PublicKey: publicKey, SecretKey: secretKey, Metadata: make(Metadata)}, nil
+}
+
+// HasSecretKey returns whether the certificate holds its secret key.
+func (c *CurveCert) HasSecretKey() bool {
+	return c.SecretKey != [32]byte{}
+}
+
+// Save saves the public certificate to filename and, if the
+// certificate holds its secret key, the secret certificate to
+// filename with a "_secret" suffix, as zcert_save does.
+func (c *CurveCert) Save(filename string) error {
+	if err := c.SavePublic(filename); err != nil {
+		return err
+	}
+	if !c.HasSecretKey() {
+		return nil
+	}
+	return c.SaveSecret(filename + curveCertSecretSuffix)
+}
+
+// SavePublic saves the public certificate, without the secret key.
+func (c *CurveCert) SavePublic(filename string) error {
+	return ioutil.WriteFile(filename, c.encode(false), 0644)
+}
+
+// SaveSecret saves the secret certificate, holding both keys.
+// Only the owner of the file can read it.
+func (c *CurveCert) SaveSecret(filename string) error {
+	if !c.HasSecretKey() {
+		return errors.New("CURVE certificate has no secret key")
+	}
+	return ioutil.WriteFile(filename, c.encode(true), 0600)
+}
+
+// encode returns the public or the secret certificate
+// in the zcert file format.
+func (c *CurveCert) encode(secret bool) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "#   ****  Generated on %v by gomq  ****\n", time.Now().Format("2006-01-02 15:04:05"))
+	if secret {
+		buf.WriteString("#   ZeroMQ CURVE **Secret** Certificate\n")
+		buf.WriteString("#   DO NOT PROVIDE THIS FILE TO OTHER USERS nor change its permissions.\n")
+	} else {
+		buf.WriteString("#   ZeroMQ CURVE Public Certificate\n")
+		buf.WriteString("#   Exchange securely, or use a secure mechanism to verify the contents\n")
+		buf.WriteString("#   of this file after exchange. Store public certificates in your home\n")
+		buf.WriteString("#   directory, in the .curve subdirectory.\n")
+	}
+	buf.WriteString("\nmetadata\n")
+
+	names := make([]string, 0, len(c.Metadata))
+	for name := range c.Metadata {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&buf, "    %v = %v\n", name, quoteZPL(c.Metadata[name]))
+	}
+
+	buf.WriteString("curve\n")
+	fmt.Fprintf(&buf, "    public-key = %v\n", quoteZPL(EncodeCurveKey(c.PublicKey)))
+	if secret {
+		fmt.Fprintf(&buf, "    secret-key = %v\n", quoteZPL(EncodeCurveKey(c.SecretKey)))
+	}
+	return buf.Bytes()
+}
+
+// LoadCurveCert loads a certificate saved by Save, or by
+// zcert_save. As zcert_load does, the secret certificate is
+// loaded if a file with a "_secret" suffix exists, and the
+// public certificate otherwise.
+func LoadCurveCert(filename string) (*CurveCert, error) {
+	data, err := ioutil.ReadFile(filename + curveCertSecretSuffix)
+	if os.IsNotExist(err) {
+		data, err = ioutil.ReadFile(filename)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := decodeCurveCert(data)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", filename, err)
+	}
+	return cert, nil
+}
+
+// decodeCurveCert decodes a certificate in the zcert file format.
+func decodeCurveCert(data []byte) (*CurveCert, error) {
+	properties, err := parseZPL(data)
+	if err != nil {
+		return nil, err
+	}
+
+	cert := &CurveCert{Metadata: make(Metadata)}
+	publicKey, ok := properties["curve/public-key"]
+	if !ok {
+		return nil, errors.New("CURVE certificate has no public key")
+	}
+	if cert.PublicKey, err = DecodeCurveKey(publicKey); err != nil {
+		return nil, err
+	}
+	if secretKey, ok := properties["curve/secret-key"]; ok {
+		if cert.SecretKey, err = DecodeCurveKey(secretKey); err != nil {
+			return nil, err
+		}
+	}
+
+	for path, value := range properties {
+		if strings.HasPrefix(path, "metadata/") {
+			cert.Metadata[strings.TrimPrefix(path, "metadata/")] = value
+		}
+	}
+	return cert, nil
+}
+
+// quoteZPL quotes a ZPL value.
+func quoteZPL(value string) string {
+	if strings.Contains(value, `"`) {
+		return "'" + value + "'"
+	}
+	return `"` + value + `"`
+}
+
+// parseZPL parses a ZPL document, as used by zcert files,
+// and returns its values by path, e.g. "curve/public-key".
+// See: https://rfc.zeromq.org/spec:4
+func parseZPL(data []byte) (map[string]string, error) {
+	values := make(map[string]string)
+	var path []string
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		content := strings.TrimLeft(line, " ")
+		if content == "" || content[0] == '#' {
+			continue
+		}
+
+		indent := len(line) - len(content)
+		if indent%4 != 0 || indent/4 > len(path) {
+			return nil, fmt.Errorf("line %v: invalid indentation", lineNumber)
+		}
+		path = path[:indent/4]
+
+		name, value := content, ""
+		if i := strings.IndexAny(content, " =#"); i >= 0 {
+			name = content[:i]
+			rest := strings.TrimLeft(content[i:], " ")
+			if strings.HasPrefix(rest, "=") {
+				var err error
+				if value, err = unquoteZPL(strings.TrimLeft(rest[1:], " ")); err != nil {
+					return nil, fmt.Errorf("line %v: %v", lineNumber, err)
+				}
+			} else if rest != "" && rest[0] != '#' {
+				return nil, fmt.Errorf("line %v: unexpected %q", lineNumber, rest)
+			}
+		}
+
+		path = append(path, name)
+		values[strings.Join(path, "/")] = value
+	}
+	return values, scanner.Err()
+}
+
+// unquoteZPL returns the value at the start of s, which may
+// be quoted, and be followed by a comment.
+func unquoteZPL(s string) (string, error) {
+	if s != "" && (s[0] == '"' || s[0] == '\'') {
+		end := strings.IndexByte(s[1:], s[0])
+		if end < 0 {
+			return "", errors.New("unterminated quoted value")
+		}
+		return s[1 : 1+end], nil
+	}
+	if end := strings.IndexAny(s, " #"); end >= 0 {
+		return s[:end], nil
+	}
+	return s, nil
+}
+
+// CurveCertStore holds the certificates of the clients allowed
+// to connect to a CURVE server, by public key. It is loaded from
+// the public certificates in a directory, and reloaded when the
+// directory changes, as zcertstore does. Its Verify and
+// Authenticate methods can be used as CurveVerifier and
+// ZAPHandler. It is goroutine safe.
+type CurveCertStore struct {
+	mu       sync.Mutex
+	dir      string
+	state    curveCertDirState
+	err      error // set if dir could not be loaded
+	loaded   map[[32]byte]*CurveCert
+	inserted map[[32]byte]*CurveCert
+}
+
+// curveCertDirState sums up the files of a certificate
+// directory, to tell when it must be reloaded.
+type curveCertDirState struct {
+	count   int
+	size    int64
+	modTime int64 // latest, in nanoseconds
+}
+
+// NewCurveCertStore returns a store loaded from the public
+// certificates in dir. Files with a "_secret" suffix are
+// ignored. If dir is empty, the store is held in memory.
+func NewCurveCertStore(dir string) (*CurveCertStore, error) {
+	s := &CurveCertStore{
+		dir:      dir,
+		loaded:   make(map[[32]byte]*CurveCert),
+		inserted: make(map[[32]byte]*CurveCert),
+	}
+	if dir == "" {
+		return s, nil
+	}
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Insert adds a certificate to the store, in memory.
+func (s *CurveCertStore) Insert(cert *CurveCert) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inserted[cert.PublicKey] = cert
+}
+
+// Lookup returns the certificate of a public key, or nil if
+// the key is unknown. The store is reloaded first if the files
+// of its directory changed. Only the certificates inserted in
+// memory are found while the directory cannot be loaded.
+func (s *CurveCertStore) Lookup(publicKey [32]byte) *CurveCert {
+	cert, _ := s.lookup(publicKey)
+	return cert
+}
+
+// lookup is Lookup, also returning the error met while
+// reloading the directory of the store, if any.
+func (s *CurveCertStore) lookup(publicKey [32]byte) (*CurveCert, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.dir != "" {
+		s.err = s.reload()
+	}
+
+	if cert, ok := s.inserted[publicKey]; ok {
+		return cert, nil
+	}
+	return s.loaded[publicKey], s.err
+}
+
+// Verify returns an error if the key of a client is not in
+// the store.
+func (s *CurveCertStore) Verify(clientKey [32]byte) error {
+	cert, err := s.lookup(clientKey)
+	if cert != nil {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Cannot load CURVE certificates: %v", err)
+	}
+	return errors.New("Unknown CURVE client key")
+}
+
+// Authenticate allows CURVE clients whose key is in the store.
+// The metadata of their certificate is added to the reply.
+func (s *CurveCertStore) Authenticate(req *ZAPRequest) *ZAPReply {
+	reply := &ZAPReply{RequestID: req.RequestID, StatusCode: ZAPStatusDenied}
+	if req.Mechanism != CurveSecurityMechanismType || len(req.Credentials) != 1 || len(req.Credentials[0]) != 32 {
+		reply.StatusText = "Not a CURVE client"
+		return reply
+	}
+
+	var clientKey [32]byte
+	copy(clientKey[:], req.Credentials[0])
+	cert, err := s.lookup(clientKey)
+	if cert == nil && err != nil {
+		reply.StatusCode = ZAPStatusInternalError
+		reply.StatusText = fmt.Sprintf("Cannot load CURVE certificates: %v", err)
+		return reply
+	}
+	if cert == nil {
+		reply.StatusText = "Unknown CURVE client key"
+		return reply
+	}
+
+	reply.StatusCode = ZAPStatusOK
+	reply.StatusText = "OK"
+	reply.Metadata = cert.Metadata
+	return reply
+}
+
+// reload loads the certificates of the directory of the store,
+// unless none of its files changed, as zcertstore does. Files
+// which are not certificates are skipped. If the directory cannot
+// be read, the certificates loaded from it so far are dropped.
+func (s *CurveCertStore) reload() error {
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		s.loaded = make(map[[32]byte]*CurveCert)
+		s.state = curveCertDirState{}
+		return err
+	}
+
+	state := curveCertDirState{count: len(files)}
+	for _, file := range files {
+		state.size += file.Size()
+		if modTime := file.ModTime().UnixNano(); modTime > state.modTime {
+			state.modTime = modTime
+		}
+	}
+	if s.err == nil && state == s.state {
+		return nil
+	}
+
+	loaded := make(map[[32]byte]*CurveCert)
+	for _, file := range files {
+		if file.IsDir() || strings.HasSuffix(file.Name(), curveCertSecretSuffix) {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(s.dir, file.Name()))
+		if err != nil {
+			continue
+		}
+		cert, err := decodeCurveCert(data)
+		if err != nil {
+			continue
+		}
+		loaded[cert.PublicKey] = cert
+	}
+
+	s.loaded = loaded
+	s.state = state
+	return nil
+}
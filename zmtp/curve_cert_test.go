@@ -0,0 +1,227 @@
+package zmtp
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/curve25519"
+)
+
+// czmqCert is a secret certificate, as saved by zcert_save,
+// holding the server keypair of the zmq_curve manual.
+const czmqCert = `#   ****  Generated on 2016-05-01 12:00:00 by CZMQ  ****
+#   ZeroMQ CURVE **Secret** Certificate
+#   DO NOT PROVIDE THIS FILE TO OTHER USERS nor change its permissions.
+
+metadata
+    name = "server"    # a comment
+    email = 'ops@example.com'
+curve
+    public-key = "rq:rM>}U?@Lns47E1%kR.o@n%FcmmsL/@{H8]yf7"
+    secret-key = "JTKVSB%%)wK0E.X)V>+}o?pNmC{O&4W4b!Ni{Lh6"
+`
+
+func TestCurveCertCZMQ(t *testing.T) {
+	cert, err := decodeCurveCert([]byte(czmqCert))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var publicKey [32]byte
+	curve25519.ScalarBaseMult(&publicKey, &cert.SecretKey)
+	if publicKey != cert.PublicKey {
+		t.Fatalf("want public key %q, got %q", EncodeCurveKey(cert.PublicKey), EncodeCurveKey(publicKey))
+	}
+
+	if want, got := "rq:rM>}U?@Lns47E1%kR.o@n%FcmmsL/@{H8]yf7", EncodeCurveKey(cert.PublicKey); want != got {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+
+	for _, tc := range []struct{ want, got string }{
+		{"server", cert.Metadata["name"]},
+		{"ops@example.com", cert.Metadata["email"]},
+	} {
+		if tc.want != tc.got {
+			t.Errorf("want %q, got %q", tc.want, tc.got)
+		}
+	}
+}
+
+func TestCurveCertSaveLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gomq-cert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cert, err := NewCurveCert()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert.Metadata["name"] = "client"
+
+	filename := filepath.Join(dir, "client.key")
+	if err := cert.Save(filename); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadCurveCert(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.PublicKey != cert.PublicKey || loaded.SecretKey != cert.SecretKey {
+		t.Fatal("want the saved keypair to be loaded")
+	}
+
+	if want, got := "client", loaded.Metadata["name"]; want != got {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+
+	if err := os.Remove(filename + "_secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err = LoadCurveCert(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.PublicKey != cert.PublicKey || loaded.HasSecretKey() {
+		t.Fatal("want the public certificate to be loaded")
+	}
+}
+
+func TestCurveCertStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gomq-certstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	known, err := NewCurveCert()
+	if err != nil {
+		t.Fatal(err)
+	}
+	known.Metadata["name"] = "known"
+	if err := known.Save(filepath.Join(dir, "known.key")); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := NewCurveCertStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert := store.Lookup(known.PublicKey)
+	if cert == nil {
+		t.Fatal("want the saved certificate to be in the store")
+	}
+
+	if cert.HasSecretKey() {
+		t.Fatal("want the store to hold public certificates only")
+	}
+
+	later, err := NewCurveCert()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Verify(later.PublicKey); err == nil {
+		t.Fatal("verifying an unknown key MUST raise error")
+	}
+
+	if err := later.Save(filepath.Join(dir, "later.key")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Verify(later.PublicKey); err != nil {
+		t.Fatalf("want the store to be reloaded, got %v", err)
+	}
+
+	client, server := newCurveMechanisms(t, nil)
+	clientConn, serverConn, err := prepareTCPWithZAP(t, client, server, store.Authenticate)
+	if err == nil {
+		clientConn.Close()
+		serverConn.Close()
+		t.Fatal("connecting with an unknown key MUST raise error")
+	}
+
+	client = NewSecurityCurveClient(client.serverKey, known.PublicKey, known.SecretKey)
+	clientConn, serverConn, err = prepareTCPWithZAP(t, client, server, store.Authenticate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clientConn.Close()
+	defer serverConn.Close()
+
+	if name, _ := serverConn.Metadata("Name"); name != "known" {
+		t.Errorf("want metadata %q, got %q", "known", name)
+	}
+}
+
+func TestCurveCertStoreReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gomq-certstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	first, err := NewCurveCert()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "client.key")
+	if err := first.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := NewCurveCertStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Verify(first.PublicKey); err != nil {
+		t.Fatal(err)
+	}
+
+	// replacing a file leaves the directory untouched
+	second, err := NewCurveCert()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Verify(second.PublicKey); err != nil {
+		t.Fatalf("want the store to be reloaded, got %v", err)
+	}
+	if err := store.Verify(first.PublicKey); err == nil {
+		t.Fatal("verifying a replaced key MUST raise error")
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	if cert := store.Lookup(second.PublicKey); cert != nil {
+		t.Fatal("want no certificate once the directory cannot be loaded")
+	}
+
+	reply := store.Authenticate(&ZAPRequest{
+		RequestID:   "1",
+		Mechanism:   CurveSecurityMechanismType,
+		Credentials: [][]byte{second.PublicKey[:]},
+	})
+	if want, got := ZAPStatusInternalError, reply.StatusCode; want != got {
+		t.Errorf("want status %q, got %q", want, got)
+	}
+}
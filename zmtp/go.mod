@@ -1,3 +1,5 @@
 module github.com/zeromq/gomq/zmtp
 
 go 1.12
+
+require golang.org/x/crypto v0.0.0-20220525230936-793ad666bf5e
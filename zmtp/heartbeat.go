@@ -0,0 +1,177 @@
+package zmtp
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrHeartbeatTimeout is the error of the connections closed
+// because nothing was received from the other end in time,
+// not even an answer to a PING.
+var ErrHeartbeatTimeout = errors.New("Heartbeat timed out")
+
+// maxPingContext is the length of the longest PING
+// context echoed in PONG commands.
+const maxPingContext = 16
+
+// heartbeat holds the heartbeat state of a connection. As libzmq
+// does, a deadline is set when a PING is sent, and when a PING
+// holding a TTL is received. The deadlines are cleared whenever
+// something is received, and the connection is closed if one of
+// them passes.
+// See: https://rfc.zeromq.org/spec:37
+type heartbeat struct {
+	ivl     time.Duration // interval between PINGs, none if zero
+	timeout time.Duration // time to receive something once a PING is sent
+	ttl     time.Duration // TTL sent in PINGs
+
+	mu           sync.Mutex
+	ping         *time.Timer // sends the next PING
+	waitDeadline time.Time   // set when a PING is sent
+	ttlDeadline  time.Time   // set when a PING holding a TTL is received
+	expired      bool
+	stopped      bool
+}
+
+// SetHeartbeat sets the heartbeat of the connection: a PING is
+// sent every ivl, and the connection is closed if nothing is
+// received within timeout once it is sent, or within ivl if
+// timeout is zero. PINGs hold ttl, for the other end to close
+// the connection if it receives nothing within ttl. Heartbeats
+// are only sent to ZMTP 3.1 peers. It must be called before
+// Prepare.
+func (c *Connection) SetHeartbeat(ivl, timeout, ttl time.Duration) {
+	if timeout == 0 {
+		timeout = ivl
+	}
+	c.heartbeat = &heartbeat{ivl: ivl, timeout: timeout, ttl: ttl}
+}
+
+// startHeartbeat starts sending PINGs, if an interval was set
+func (c *Connection) startHeartbeat() {
+	if c.heartbeat == nil {
+		// The TTL of PINGs received is honoured all the same
+		c.heartbeat = &heartbeat{}
+	}
+
+	h := c.heartbeat
+	if h.ivl > 0 {
+		h.mu.Lock()
+		h.ping = time.AfterFunc(h.ivl, c.sendPing)
+		h.mu.Unlock()
+	}
+}
+
+// stopHeartbeat stops sending PINGs and checking deadlines
+func (c *Connection) stopHeartbeat() {
+	h := c.heartbeat
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.stopped = true
+	if h.ping != nil {
+		h.ping.Stop()
+	}
+}
+
+// sendPing sends a PING holding the TTL, and schedules the next one
+func (c *Connection) sendPing() {
+	h := c.heartbeat
+	h.mu.Lock()
+	if h.stopped {
+		h.mu.Unlock()
+		return
+	}
+	if h.timeout > 0 && h.waitDeadline.IsZero() {
+		h.waitDeadline = time.Now().Add(h.timeout)
+		time.AfterFunc(h.timeout, c.checkHeartbeat)
+	}
+	h.ping.Reset(h.ivl)
+	h.mu.Unlock()
+
+	// TTL in deciseconds
+	ttl := h.ttl / (100 * time.Millisecond)
+	if ttl > 0xffff {
+		ttl = 0xffff
+	}
+	var body [2]byte
+	byteOrder.PutUint16(body[:], uint16(ttl))
+
+	// Errors are up to the reader of the connection
+	c.SendCommand("PING", body[:])
+}
+
+// handlePing answers a PING with a PONG echoing its context, and
+// expects to receive something within the TTL of the PING, if any
+func (c *Connection) handlePing(body []byte) error {
+	var ttl time.Duration
+	if len(body) >= 2 {
+		ttl = time.Duration(byteOrder.Uint16(body[:2])) * 100 * time.Millisecond
+		body = body[2:]
+	}
+	if len(body) > maxPingContext {
+		body = body[:maxPingContext]
+	}
+
+	if h := c.heartbeat; h != nil && ttl > 0 {
+		h.mu.Lock()
+		if !h.stopped && h.ttlDeadline.IsZero() {
+			h.ttlDeadline = time.Now().Add(ttl)
+			time.AfterFunc(ttl, c.checkHeartbeat)
+		}
+		h.mu.Unlock()
+	}
+
+	return c.SendCommand("PONG", body)
+}
+
+// heartbeatReceived clears the deadlines, as something was received
+func (c *Connection) heartbeatReceived() {
+	h := c.heartbeat
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	h.waitDeadline = time.Time{}
+	h.ttlDeadline = time.Time{}
+	h.mu.Unlock()
+}
+
+// checkHeartbeat closes the connection if one of the deadlines passed
+func (c *Connection) checkHeartbeat() {
+	h := c.heartbeat
+	h.mu.Lock()
+	now := time.Now()
+	passed := func(deadline time.Time) bool {
+		return !deadline.IsZero() && !now.Before(deadline)
+	}
+	if h.stopped || !passed(h.waitDeadline) && !passed(h.ttlDeadline) {
+		h.mu.Unlock()
+		return
+	}
+	h.expired = true
+	h.mu.Unlock()
+
+	c.Close()
+}
+
+// heartbeatError returns ErrHeartbeatTimeout instead of err,
+// the error of a read, if the heartbeat closed the connection
+func (c *Connection) heartbeatError(err error) error {
+	h := c.heartbeat
+	if h == nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.expired {
+		return ErrHeartbeatTimeout
+	}
+	return err
+}
@@ -0,0 +1,120 @@
+package zmtp
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHeartbeat(t *testing.T) {
+	client, server, err := prepareTCPWith(t, NewSecurityNull(), NewSecurityNull(), func(clientConn, serverConn *Connection) {
+		clientConn.SetHeartbeat(10*time.Millisecond, 50*time.Millisecond, time.Second)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	defer server.Close()
+
+	clientMsgs := make(chan *Message, 1)
+	client.RecvMultipart(clientMsgs)
+
+	serverMsgs := make(chan *Message, 1)
+	server.RecvMultipart(serverMsgs)
+
+	// PINGs are answered, PONGs are not passed on
+	time.Sleep(100 * time.Millisecond)
+
+	select {
+	case msg := <-clientMsgs:
+		t.Fatalf("want no message, got %v", msg)
+	case msg := <-serverMsgs:
+		t.Fatalf("want no message, got %v", msg)
+	default:
+	}
+
+	if err := client.SendMultipart([][]byte{[]byte("HELLO")}); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := <-serverMsgs
+	if msg.Err != nil {
+		t.Fatal(msg.Err)
+	}
+
+	if want, got := "HELLO", string(msg.Body[0]); want != got {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+}
+
+func TestHeartbeatTimeout(t *testing.T) {
+	client, server, err := prepareTCPWith(t, NewSecurityNull(), NewSecurityNull(), func(clientConn, serverConn *Connection) {
+		clientConn.SetHeartbeat(10*time.Millisecond, 30*time.Millisecond, 0)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	defer server.Close()
+
+	// The server does not read, PINGs are not answered
+	msgs := make(chan *Message, 1)
+	client.RecvMultipart(msgs)
+
+	select {
+	case msg := <-msgs:
+		if msg.Err != ErrHeartbeatTimeout {
+			t.Fatalf("want error %v, got %v", ErrHeartbeatTimeout, msg.Err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("want the connection to time out")
+	}
+}
+
+func TestHeartbeatTTL(t *testing.T) {
+	client, server, err := prepareTCP(t, NewSecurityNull(), NewSecurityNull())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	defer server.Close()
+
+	msgs := make(chan *Message, 1)
+	server.RecvMultipart(msgs)
+
+	// TTL of 1 decisecond, and a context
+	if err := client.SendCommand("PING", []byte("\x00\x01context")); err != nil {
+		t.Fatal(err)
+	}
+
+	isCommand, body, err := client.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !isCommand {
+		t.Fatal("want a PONG command")
+	}
+
+	command, err := client.parseCommand(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := "PONG", command.Name; want != got {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+
+	if want, got := "context", string(command.Body); want != got {
+		t.Fatalf("want context %q, got %q", want, got)
+	}
+
+	// Nothing more is sent within the TTL
+	select {
+	case msg := <-msgs:
+		if msg.Err != ErrHeartbeatTimeout {
+			t.Fatalf("want error %v, got %v", ErrHeartbeatTimeout, msg.Err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("want the connection to time out")
+	}
+}
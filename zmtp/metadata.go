@@ -0,0 +1,85 @@
+package zmtp
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Metadata holds the properties of a connection, as sent
+// in READY and INITIATE commands. Property names are
+// case-insensitive.
+type Metadata map[string]string
+
+// Encode encodes the properties in the format of the body
+// of a READY command.
+func (m Metadata) Encode() ([]byte, error) {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		if len(name) == 0 || len(name) > 255 {
+			return nil, fmt.Errorf("Invalid metadata property name %q", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf []byte
+	for _, name := range names {
+		value := m[name]
+		buf = append(buf, byte(len(name)))
+		buf = append(buf, name...)
+		var length [4]byte
+		byteOrder.PutUint32(length[:], uint32(len(value)))
+		buf = append(buf, length[:]...)
+		buf = append(buf, value...)
+	}
+	return buf, nil
+}
+
+// DecodeMetadata decodes properties encoded by Metadata.Encode.
+// Property names are lowercased.
+func DecodeMetadata(buf []byte) (Metadata, error) {
+	m := make(Metadata)
+	for len(buf) > 0 {
+		// Name length
+		nameLength := int(buf[0])
+		if 1+nameLength+4 > len(buf) {
+			return nil, errors.New("metadata property overflows the body")
+		}
+
+		// Name
+		name := strings.ToLower(string(buf[1 : 1+nameLength]))
+		buf = buf[1+nameLength:]
+
+		// Value length
+		valueLength := uint64(byteOrder.Uint32(buf[:4]))
+		buf = buf[4:]
+		if valueLength > uint64(len(buf)) {
+			return nil, fmt.Errorf("metadata value of length %v overflows body of length %v", valueLength, len(buf))
+		}
+
+		// Value
+		m[name] = string(buf[:valueLength])
+		buf = buf[valueLength:]
+	}
+	return m, nil
+}
+
+// decodePeerMetadata decodes the properties sent by the other
+// end. Properties named "Peer-*" are dropped, whether or not
+// the transport set them, as well as "User-Id": they are only
+// ever set locally, the user id coming from the ZAP reply or
+// the PLAIN username.
+func decodePeerMetadata(buf []byte) (Metadata, error) {
+	metadata, err := DecodeMetadata(buf)
+	if err != nil {
+		return nil, err
+	}
+	for k := range metadata {
+		if strings.HasPrefix(k, "peer-") || k == "user-id" {
+			delete(metadata, k)
+		}
+	}
+	return metadata, nil
+}
@@ -0,0 +1,37 @@
+package zmtp
+
+import (
+	"testing"
+)
+
+func TestMetadata(t *testing.T) {
+	metadata := Metadata{
+		"Socket-Type": "DEALER",
+		"Identity":    "",
+		"X-Hello":     "World",
+	}
+
+	buf, err := metadata.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := DecodeMetadata(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := len(metadata), len(decoded); want != got {
+		t.Fatalf("want %v properties, got %v", want, got)
+	}
+
+	for name, value := range map[string]string{"socket-type": "DEALER", "identity": "", "x-hello": "World"} {
+		if got, ok := decoded[name]; !ok || got != value {
+			t.Errorf("want %q for %q, got %q", value, name, got)
+		}
+	}
+
+	if _, err := DecodeMetadata(buf[:len(buf)-1]); err == nil {
+		t.Errorf("want error for truncated metadata")
+	}
+}
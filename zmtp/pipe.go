@@ -0,0 +1,83 @@
+package zmtp
+
+import (
+	"io"
+	"sync"
+)
+
+// pipeCapacity is the number of messages a pipe
+// buffers in each direction.
+const pipeCapacity = 1000
+
+type pipeMessage struct {
+	isCommand bool
+	frames    [][]byte
+}
+
+// pipe is one end of an in-memory transport. Messages
+// are passed as is, without being encoded.
+type pipe struct {
+	in   <-chan pipeMessage
+	out  chan<- pipeMessage
+	done chan struct{} // closed when either end is closed
+	once *sync.Once
+}
+
+// NewPipe returns two Connections linked to each other in memory.
+// Messages sent on a Connection are received on the other one
+// without any wire encoding. The frames are not copied, so they
+// must not be modified once sent.
+// As the Connections stay within the process, their handshake
+// is limited to the exchange of metadata.
+func NewPipe() (*Connection, *Connection) {
+	var (
+		ab   = make(chan pipeMessage, pipeCapacity)
+		ba   = make(chan pipeMessage, pipeCapacity)
+		done = make(chan struct{})
+		once = &sync.Once{}
+	)
+
+	a := NewConnection(nil)
+	a.pipe = &pipe{in: ba, out: ab, done: done, once: once}
+	b := NewConnection(nil)
+	b.pipe = &pipe{in: ab, out: ba, done: done, once: once}
+	return a, b
+}
+
+func (p *pipe) write(isCommand bool, frames [][]byte) error {
+	select {
+	case <-p.done:
+		return io.ErrClosedPipe
+	default:
+	}
+
+	select {
+	case p.out <- pipeMessage{isCommand: isCommand, frames: frames}:
+		return nil
+	case <-p.done:
+		return io.ErrClosedPipe
+	}
+}
+
+// read returns the next message of the pipe. Messages sent
+// before the pipe was closed are still delivered, the end of
+// the pipe is only reported once they are all read.
+func (p *pipe) read() (bool, [][]byte, error) {
+	select {
+	case msg := <-p.in:
+		return msg.isCommand, msg.frames, nil
+	case <-p.done:
+	}
+
+	select {
+	case msg := <-p.in:
+		return msg.isCommand, msg.frames, nil
+	default:
+		return false, nil, io.EOF
+	}
+}
+
+func (p *pipe) close() error {
+	p.once.Do(func() { close(p.done) })
+	return nil
+}
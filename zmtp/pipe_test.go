@@ -0,0 +1,90 @@
+package zmtp
+
+import (
+	"testing"
+)
+
+func preparePipe(aType, bType SocketType) (*Connection, *Connection, error) {
+	a, b := NewPipe()
+
+	errs := make(chan error)
+	go func() {
+		_, err := b.Prepare(NewSecurityNull(), bType, SocketIdentity("b"), true, nil)
+		errs <- err
+	}()
+
+	_, err := a.Prepare(NewSecurityNull(), aType, SocketIdentity("a"), false, nil)
+	if errB := <-errs; err == nil {
+		err = errB
+	}
+	return a, b, err
+}
+
+func TestPipe(t *testing.T) {
+	a, b, err := preparePipe(PushSocketType, PullSocketType)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if id, _ := b.GetIdentity(); id != "a" {
+		t.Errorf("want identity %q, got %q", "a", id)
+	}
+
+	err = a.SendMultipart([][]byte{[]byte("HELLO"), []byte("WORLD")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msgs := make(chan *Message)
+	b.RecvMultipart(msgs)
+
+	msg := <-msgs
+	if msg.Err != nil {
+		t.Fatal(msg.Err)
+	}
+
+	if want, got := 2, len(msg.Body); want != got {
+		t.Fatalf("want %v frames, got %v", want, got)
+	}
+
+	a.Close()
+	if msg := <-msgs; msg.Err == nil {
+		t.Errorf("want error once the pipe is closed")
+	}
+}
+
+func TestPipeDrainOnClose(t *testing.T) {
+	a, b, err := preparePipe(PushSocketType, PullSocketType)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const count = 100
+	for i := 0; i < count; i++ {
+		err = a.SendMultipart([][]byte{[]byte("HELLO")})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	a.Close()
+
+	msgs := make(chan *Message)
+	b.RecvMultipart(msgs)
+
+	for i := 0; i < count; i++ {
+		if msg := <-msgs; msg.Err != nil {
+			t.Fatalf("message %v: want messages sent before close, got %v", i, msg.Err)
+		}
+	}
+
+	if msg := <-msgs; msg.Err == nil {
+		t.Errorf("want error once the pipe is drained")
+	}
+}
+
+func TestPipeIncompatibleSockets(t *testing.T) {
+	_, _, err := preparePipe(PushSocketType, PushSocketType)
+	if err == nil {
+		t.Errorf("want error for incompatible socket types")
+	}
+}
@@ -15,12 +15,28 @@ const (
 	signatureSuffix = 0x7F
 )
 
+const (
+	// greetingLength is the length of ZMTP 3.x greetings
+	greetingLength = 64
+
+	// greetingPrefixLength is the length of the signature
+	// and the major version, exchanged before the rest of
+	// the greeting to detect ZMTP 2.0 peers
+	greetingPrefixLength = 11
+)
+
 const (
 	hasMoreBitFlag   = 0x1
 	isLongBitFlag    = 0x2
 	isCommandBitFlag = 0x4
 )
 
+// Flags of the frames carried in MESSAGE commands
+const (
+	messageHasMoreFlag   = 0x1
+	messageIsCommandFlag = 0x2
+)
+
 // MessageType represents a "type" of ZMTP message
 // (User, Command, Error)
 type MessageType int
@@ -38,8 +54,37 @@ const (
 
 var (
 	version = [2]uint8{majorVersion, minorVersion}
+
+	// version30 is the version of ZMTP 3.0 peers, which
+	// send subscriptions as messages instead of commands
+	version30 = [2]uint8{majorVersion, 0}
+
+	// version20 is the version of ZMTP 2.0 peers, which
+	// have no commands at all
+	version20 = [2]uint8{2, 0}
 )
 
+// zmtp20Revision is the revision of ZMTP 2.0 greetings,
+// sent instead of the major version.
+const zmtp20Revision = 0x01
+
+// zmtp20SocketTypes are the socket types sent in ZMTP 2.0
+// greetings, as numbered by libzmq.
+// See: https://rfc.zeromq.org/spec:15
+var zmtp20SocketTypes = map[SocketType]byte{
+	PairSocketType:   0,
+	PubSocketType:    1,
+	SubSocketType:    2,
+	ReqSocketType:    3,
+	RepSocketType:    4,
+	DealerSocketType: 5,
+	RouterSocketType: 6,
+	PullSocketType:   7,
+	PushSocketType:   8,
+	XPubSocketType:   9,
+	XSubSocketType:   10,
+}
+
 var byteOrder = binary.BigEndian
 
 const maxUint = ^uint(0)
@@ -62,11 +107,16 @@ type greeting struct {
 }
 
 func (g *greeting) unmarshal(r io.Reader) error {
-	var buf [64]byte
+	var buf [greetingLength]byte
 	_, err := io.ReadFull(r, buf[:])
 	if err != nil {
 		return err
 	}
+	g.decode(buf)
+	return nil
+}
+
+func (g *greeting) decode(buf [greetingLength]byte) {
 	g.SignaturePrefix = buf[0]
 	// padding 1 ignored
 	g.SignatureSuffix = buf[9]
@@ -75,12 +125,15 @@ func (g *greeting) unmarshal(r io.Reader) error {
 	copy(g.Mechanism[:], buf[12:32])
 	g.ServerFlag = buf[32]
 	// padding 2 ignored
-
-	return nil
 }
 
 func (g *greeting) marshal(w io.Writer) error {
-	var buf [64]byte
+	buf := g.encode()
+	_, err := w.Write(buf[:])
+	return err
+}
+
+func (g *greeting) encode() (buf [greetingLength]byte) {
 	buf[0] = g.SignaturePrefix
 	// padding 1 ignored
 	buf[9] = g.SignatureSuffix
@@ -90,8 +143,7 @@ func (g *greeting) marshal(w io.Writer) error {
 	buf[32] = g.ServerFlag
 	// padding 2 ignored
 
-	_, err := w.Write(buf[:])
-	return err
+	return buf
 }
 
 // Command represents an underlying ZMTP command
@@ -108,4 +160,11 @@ type Message struct {
 	Body        [][]byte
 	Err         error
 	MessageType MessageType
+
+	// RoutingID is the routing id of the peer the
+	// message was received from.
+	RoutingID string
+
+	// Group is the group of a RADIO/DISH message.
+	Group string
 }
@@ -1,5 +1,7 @@
 package zmtp
 
+import "fmt"
+
 // SecurityMechanismType denotes types of ZMTP security mechanisms
 type SecurityMechanismType string
 
@@ -18,9 +20,71 @@ const (
 	CurveSecurityMechanismType SecurityMechanismType = "CURVE"
 )
 
-// SecurityMechanism is an interface for ZMTP security mechanisms
+// SecurityMechanism is an interface for ZMTP security mechanisms.
+//
+// Handshake runs the handshake of the mechanism over the commands
+// of a connection, once the greetings have been exchanged. It sends
+// metadata, the properties of this end, and returns the properties
+// of the other end. It also returns the Codec of the connection,
+// or nil if frames are sent as they are.
+//
+// A mechanism may be shared by many connections, any state of a
+// connection belongs to its Codec.
 type SecurityMechanism interface {
 	Type() SecurityMechanismType
-	Handshake() error
-	Encrypt([]byte) []byte
+	Handshake(rw CommandReadWriter, asServer bool, peer Greeting, metadata Metadata) (Metadata, Codec, error)
+}
+
+// CommandReadWriter reads and writes the commands
+// of a connection during the security handshake.
+// ReadCommand returns an ERROR command sent by the
+// other end as an error.
+type CommandReadWriter interface {
+	ReadCommand() (*Command, error)
+	WriteCommand(name string, body []byte) error
+}
+
+// Greeting is the greeting sent by the other end of a
+// connection.
+type Greeting struct {
+	Version   [2]uint8
+	Mechanism SecurityMechanismType
+	AsServer  bool
+}
+
+// Frame is a ZMTP frame.
+type Frame struct {
+	IsCommand bool
+	HasMore   bool
+	Body      []byte
+}
+
+// Codec encodes the frames sent on a connection, and
+// decodes the frames received, once the security handshake
+// is done, e.g. to encrypt them.
+type Codec interface {
+	Encode(Frame) (Frame, error)
+	Decode(Frame) (Frame, error)
+}
+
+// errorBody returns the body of an ERROR command.
+func errorBody(reason string) []byte {
+	if len(reason) > 255 {
+		reason = reason[:255]
+	}
+	body := make([]byte, 0, 1+len(reason))
+	body = append(body, byte(len(reason)))
+	return append(body, reason...)
+}
+
+// expectCommand reads a command, which must be called name.
+func expectCommand(rw CommandReadWriter, name string) (*Command, error) {
+	command, err := rw.ReadCommand()
+	if err != nil {
+		return nil, err
+	}
+	if command.Name != name {
+		return nil, fmt.Errorf("Got a %v command instead of the expected %v command", command.Name, name)
+	}
+	return command, nil
 }
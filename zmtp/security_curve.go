@@ -0,0 +1,362 @@
+package zmtp
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/nacl/box"
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+// CurveVerifier verifies the long-term public key of a CURVE
+// client. A non-nil error rejects the client, its text being
+// sent to the client as the reason of an ERROR command.
+type CurveVerifier func(clientKey [32]byte) error
+
+// SecurityCurve implements the CurveSecurityMechanismType.
+// Clients authenticate servers, and optionally servers
+// clients, with their long-term keys, and each connection
+// is encrypted with keys of its own.
+// See: https://rfc.zeromq.org/spec:26
+type SecurityCurve struct {
+	publicKey [32]byte
+	secretKey [32]byte
+	serverKey [32]byte // long-term public key of the server, for clients
+	verify    CurveVerifier
+}
+
+// curveCodec encrypts the frames of a CURVE connection
+// in MESSAGE commands.
+type curveCodec struct {
+	asServer  bool
+	key       [32]byte // precomputed key of the short-term key pairs
+	nonce     uint64   // short nonce of the next command sent
+	peerNonce uint64   // short nonce of the last command received
+}
+
+// NewSecurityCurveClient returns a SecurityCurve mechanism for
+// clients, with their long-term key pair and the long-term public
+// key of the server they connect to.
+func NewSecurityCurveClient(serverKey, publicKey, secretKey [32]byte) *SecurityCurve {
+	return &SecurityCurve{
+		publicKey: publicKey,
+		secretKey: secretKey,
+		serverKey: serverKey,
+	}
+}
+
+// NewSecurityCurveServer returns a SecurityCurve mechanism for
+// servers, with their long-term key pair. If verify is not nil,
+// it is used to authenticate the clients, as is the ZAP handler
+// of the server, if any. Otherwise any client is accepted.
+func NewSecurityCurveServer(publicKey, secretKey [32]byte, verify CurveVerifier) *SecurityCurve {
+	return &SecurityCurve{
+		publicKey: publicKey,
+		secretKey: secretKey,
+		verify:    verify,
+	}
+}
+
+// Type returns the security mechanisms type
+func (s *SecurityCurve) Type() SecurityMechanismType {
+	return CurveSecurityMechanismType
+}
+
+// Handshake performs the ZMTP handshake for this
+// security mechanism: HELLO, WELCOME, INITIATE and READY
+// commands, the last two carrying the metadata.
+func (s *SecurityCurve) Handshake(rw CommandReadWriter, asServer bool, peer Greeting, metadata Metadata) (Metadata, Codec, error) {
+	body, err := metadata.Encode()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	codec := &curveCodec{asServer: asServer, nonce: 1}
+	var (
+		peerBody []byte
+		reply    *ZAPReply
+	)
+	if asServer {
+		peerBody, reply, err = s.serverHandshake(rw, codec, body)
+	} else {
+		peerBody, err = s.clientHandshake(rw, codec, body)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	peerMetadata, err := decodePeerMetadata(peerBody)
+	if err != nil {
+		return nil, nil, err
+	}
+	reply.addTo(peerMetadata)
+	return peerMetadata, codec, nil
+}
+
+func (s *SecurityCurve) clientHandshake(rw CommandReadWriter, codec *curveCodec, metadata []byte) ([]byte, error) {
+	cnPublic, cnSecret, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	// HELLO: version, padding, C', short nonce, Box[64 * %x0](C'->S)
+	nonce := codec.shortNonce("CurveZMQHELLO---")
+	hello := make([]byte, 0, 194)
+	hello = append(hello, 1, 0)
+	hello = append(hello, make([]byte, 72)...)
+	hello = append(hello, cnPublic[:]...)
+	hello = append(hello, nonce[16:]...)
+	hello = box.Seal(hello, make([]byte, 64), &nonce, &s.serverKey, cnSecret)
+	if err := rw.WriteCommand("HELLO", hello); err != nil {
+		return nil, err
+	}
+
+	// WELCOME: long nonce, Box[S' + cookie](S->C')
+	command, err := expectCommand(rw, "WELCOME")
+	if err != nil {
+		return nil, err
+	}
+	if len(command.Body) != 160 {
+		return nil, errors.New("Got a malformed WELCOME command")
+	}
+	nonce = longNonce("WELCOME-", command.Body[:16])
+	welcome, ok := box.Open(nil, command.Body[16:], &nonce, &s.serverKey, cnSecret)
+	if !ok {
+		return nil, errors.New("Got a WELCOME command that could not be opened")
+	}
+
+	var snPublic [32]byte
+	copy(snPublic[:], welcome[:32])
+	cookie := welcome[32:]
+	box.Precompute(&codec.key, &snPublic, cnSecret)
+
+	// INITIATE: cookie, short nonce, Box[C + vouch + metadata](C'->S'),
+	// where vouch is Box[C' + S](C->S')
+	var vouchNonce [24]byte
+	copy(vouchNonce[:], "VOUCH---")
+	if _, err := io.ReadFull(rand.Reader, vouchNonce[8:]); err != nil {
+		return nil, err
+	}
+	vouch := make([]byte, 0, 64)
+	vouch = append(vouch, cnPublic[:]...)
+	vouch = append(vouch, s.serverKey[:]...)
+
+	plaintext := make([]byte, 0, 128+len(metadata))
+	plaintext = append(plaintext, s.publicKey[:]...)
+	plaintext = append(plaintext, vouchNonce[8:]...)
+	plaintext = box.Seal(plaintext, vouch, &vouchNonce, &snPublic, &s.secretKey)
+	plaintext = append(plaintext, metadata...)
+
+	nonce = codec.shortNonce("CurveZMQINITIATE")
+	initiate := make([]byte, 0, 96+8+box.Overhead+len(plaintext))
+	initiate = append(initiate, cookie...)
+	initiate = append(initiate, nonce[16:]...)
+	initiate = box.SealAfterPrecomputation(initiate, plaintext, &nonce, &codec.key)
+	if err := rw.WriteCommand("INITIATE", initiate); err != nil {
+		return nil, err
+	}
+
+	// READY: short nonce, Box[metadata](S'->C')
+	command, err = expectCommand(rw, "READY")
+	if err != nil {
+		return nil, err
+	}
+	return codec.openShort("CurveZMQREADY---", command.Body)
+}
+
+func (s *SecurityCurve) serverHandshake(rw CommandReadWriter, codec *curveCodec, metadata []byte) ([]byte, *ZAPReply, error) {
+	// HELLO
+	command, err := expectCommand(rw, "HELLO")
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(command.Body) != 194 {
+		return nil, nil, errors.New("Got a malformed HELLO command")
+	}
+	if command.Body[0] != 1 || command.Body[1] != 0 {
+		return nil, nil, fmt.Errorf("CURVE version %v.%v is not supported", command.Body[0], command.Body[1])
+	}
+
+	var cnPublic [32]byte
+	copy(cnPublic[:], command.Body[74:106])
+	nonce := longNonce("CurveZMQHELLO---", command.Body[106:114])
+	hello, ok := box.Open(nil, command.Body[114:], &nonce, &cnPublic, &s.secretKey)
+	if !ok || subtle.ConstantTimeCompare(hello, make([]byte, 64)) != 1 {
+		return nil, nil, errors.New("Got a HELLO command that could not be opened")
+	}
+
+	// WELCOME, with a cookie only the server can open,
+	// Box[C' + s'](K), K being a key of the connection
+	snPublic, snSecret, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var cookieKey [32]byte
+	var cookieNonce [24]byte
+	copy(cookieNonce[:], "COOKIE--")
+	if _, err := io.ReadFull(rand.Reader, cookieKey[:]); err != nil {
+		return nil, nil, err
+	}
+	if _, err := io.ReadFull(rand.Reader, cookieNonce[8:]); err != nil {
+		return nil, nil, err
+	}
+	cookie := make([]byte, 0, 96)
+	cookie = append(cookie, cookieNonce[8:]...)
+	cookie = secretbox.Seal(cookie, append(cnPublic[:], snSecret[:]...), &cookieNonce, &cookieKey)
+
+	var welcomeNonce [24]byte
+	copy(welcomeNonce[:], "WELCOME-")
+	if _, err := io.ReadFull(rand.Reader, welcomeNonce[8:]); err != nil {
+		return nil, nil, err
+	}
+	welcome := make([]byte, 0, 160)
+	welcome = append(welcome, welcomeNonce[8:]...)
+	welcome = box.Seal(welcome, append(snPublic[:], cookie...), &welcomeNonce, &cnPublic, &s.secretKey)
+	if err := rw.WriteCommand("WELCOME", welcome); err != nil {
+		return nil, nil, err
+	}
+
+	// INITIATE
+	command, err = expectCommand(rw, "INITIATE")
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(command.Body) < 96+8+box.Overhead+128 {
+		return nil, nil, errors.New("Got a malformed INITIATE command")
+	}
+
+	copy(cookieNonce[8:], command.Body[:16])
+	keys, ok := secretbox.Open(nil, command.Body[16:96], &cookieNonce, &cookieKey)
+	if !ok || !bytes.Equal(keys[:32], cnPublic[:]) || !bytes.Equal(keys[32:], snSecret[:]) {
+		return nil, nil, errors.New("Got an INITIATE command with an invalid cookie")
+	}
+
+	box.Precompute(&codec.key, &cnPublic, snSecret)
+	initiate, err := codec.openShort("CurveZMQINITIATE", command.Body[96:])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var clientKey [32]byte
+	copy(clientKey[:], initiate[:32])
+	vouchNonce := longNonce("VOUCH---", initiate[32:48])
+	vouch, ok := box.Open(nil, initiate[48:128], &vouchNonce, &clientKey, snSecret)
+	if !ok || !bytes.Equal(vouch[:32], cnPublic[:]) || !bytes.Equal(vouch[32:], s.publicKey[:]) {
+		return nil, nil, errors.New("Got an INITIATE command with an invalid vouch")
+	}
+
+	reply, err := authenticate(rw, CurveSecurityMechanismType, clientKey[:])
+	if err != nil {
+		return nil, nil, err
+	}
+	if s.verify != nil {
+		if err := s.verify(clientKey); err != nil {
+			rw.WriteCommand("ERROR", errorBody(err.Error()))
+			return nil, nil, fmt.Errorf("CURVE client rejected: %v", err)
+		}
+	}
+
+	// READY
+	nonce = codec.shortNonce("CurveZMQREADY---")
+	ready := make([]byte, 0, 8+box.Overhead+len(metadata))
+	ready = append(ready, nonce[16:]...)
+	ready = box.SealAfterPrecomputation(ready, metadata, &nonce, &codec.key)
+	return initiate[128:], reply, rw.WriteCommand("READY", ready)
+}
+
+// Encode encrypts a frame, along with its flags,
+// in a MESSAGE command.
+func (c *curveCodec) Encode(frame Frame) (Frame, error) {
+	var flags byte
+	if frame.HasMore {
+		flags |= messageHasMoreFlag
+	}
+	if frame.IsCommand {
+		flags |= messageIsCommandFlag
+	}
+	plaintext := make([]byte, 1+len(frame.Body))
+	plaintext[0] = flags
+	copy(plaintext[1:], frame.Body)
+
+	prefix := "CurveZMQMESSAGEC"
+	if c.asServer {
+		prefix = "CurveZMQMESSAGES"
+	}
+
+	nonce := c.shortNonce(prefix)
+	message := make([]byte, 0, 16+box.Overhead+len(plaintext))
+	message = append(message, "\x07MESSAGE"...)
+	message = append(message, nonce[16:]...)
+	return Frame{Body: box.SealAfterPrecomputation(message, plaintext, &nonce, &c.key)}, nil
+}
+
+// Decode decrypts a frame sent in a MESSAGE command.
+func (c *curveCodec) Decode(frame Frame) (Frame, error) {
+	if !bytes.HasPrefix(frame.Body, []byte("\x07MESSAGE")) {
+		return Frame{}, errors.New("Got an encrypted frame that is not a MESSAGE command")
+	}
+
+	prefix := "CurveZMQMESSAGES"
+	if c.asServer {
+		prefix = "CurveZMQMESSAGEC"
+	}
+	plaintext, err := c.openShort(prefix, frame.Body[8:])
+	if err != nil {
+		return Frame{}, err
+	}
+	if len(plaintext) == 0 {
+		return Frame{}, errors.New("Got an encrypted frame without flags")
+	}
+
+	flags := plaintext[0]
+	return Frame{
+		IsCommand: flags&messageIsCommandFlag != 0,
+		HasMore:   flags&messageHasMoreFlag != 0,
+		Body:      plaintext[1:],
+	}, nil
+}
+
+// shortNonce returns the nonce of the next command sent,
+// made of prefix followed by an increasing 8 octet counter.
+func (c *curveCodec) shortNonce(prefix string) [24]byte {
+	var nonce [24]byte
+	copy(nonce[:], prefix)
+	byteOrder.PutUint64(nonce[16:], c.nonce)
+	c.nonce++
+	return nonce
+}
+
+// openShort opens the box of a command made of a short nonce
+// followed by the box, encrypted with the session key. Short
+// nonces must increase, so that commands cannot be replayed.
+func (c *curveCodec) openShort(prefix string, body []byte) ([]byte, error) {
+	if len(body) < 8+box.Overhead {
+		return nil, errors.New("Got a malformed CURVE command")
+	}
+
+	shortNonce := byteOrder.Uint64(body[:8])
+	if shortNonce <= c.peerNonce {
+		return nil, errors.New("Got a CURVE command with an invalid nonce")
+	}
+
+	nonce := longNonce(prefix, body[:8])
+	plaintext, ok := box.OpenAfterPrecomputation(nil, body[8:], &nonce, &c.key)
+	if !ok {
+		return nil, errors.New("Got a CURVE command that could not be opened")
+	}
+	c.peerNonce = shortNonce
+	return plaintext, nil
+}
+
+// longNonce returns the nonce made of prefix followed by suffix.
+func longNonce(prefix string, suffix []byte) [24]byte {
+	var nonce [24]byte
+	copy(nonce[:], prefix)
+	copy(nonce[len(prefix):], suffix)
+	return nonce
+}
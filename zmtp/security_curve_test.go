@@ -0,0 +1,95 @@
+package zmtp
+
+import (
+	"crypto/rand"
+	"errors"
+	"testing"
+
+	"golang.org/x/crypto/nacl/box"
+)
+
+func newCurveMechanisms(t *testing.T, verify CurveVerifier) (*SecurityCurve, *SecurityCurve) {
+	serverPublic, serverSecret, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientPublic, clientSecret, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewSecurityCurveClient(*serverPublic, *clientPublic, *clientSecret),
+		NewSecurityCurveServer(*serverPublic, *serverSecret, verify)
+}
+
+func TestSecurityCurve(t *testing.T) {
+	clientMechanism, serverMechanism := newCurveMechanisms(t, nil)
+
+	client, server, err := prepareTCP(t, clientMechanism, serverMechanism)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	defer server.Close()
+
+	if id, _ := server.GetIdentity(); id != "client" {
+		t.Errorf("want identity %q, got %q", "client", id)
+	}
+
+	if id, _ := client.GetIdentity(); id != "server" {
+		t.Errorf("want identity %q, got %q", "server", id)
+	}
+
+	msgs := make(chan *Message)
+	server.RecvMultipart(msgs)
+
+	for i := 0; i < 3; i++ {
+		err = client.SendMultipart([][]byte{[]byte("HELLO"), []byte("WORLD")})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		msg := <-msgs
+		if msg.Err != nil {
+			t.Fatal(msg.Err)
+		}
+
+		if want, got := 2, len(msg.Body); want != got {
+			t.Fatalf("want %v frames, got %v", want, got)
+		}
+
+		if want, got := "WORLD", string(msg.Body[1]); want != got {
+			t.Fatalf("want %q, got %q", want, got)
+		}
+	}
+
+	err = client.SendCommand("SUBSCRIBE", []byte("topic"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := <-msgs
+	if want, got := "SUBSCRIBE", msg.Name; want != got {
+		t.Fatalf("want command %q, got %q", want, got)
+	}
+}
+
+func TestSecurityCurveRejected(t *testing.T) {
+	clientMechanism, serverMechanism := newCurveMechanisms(t, func(clientKey [32]byte) error {
+		return errors.New("unknown client key")
+	})
+
+	_, _, err := prepareTCP(t, clientMechanism, serverMechanism)
+	if err == nil {
+		t.Fatal("want error for a rejected client key")
+	}
+}
+
+func TestSecurityCurveWrongServerKey(t *testing.T) {
+	clientMechanism, _ := newCurveMechanisms(t, nil)
+	_, serverMechanism := newCurveMechanisms(t, nil)
+
+	_, _, err := prepareTCP(t, clientMechanism, serverMechanism)
+	if err == nil {
+		t.Fatal("want error for a wrong server key")
+	}
+}
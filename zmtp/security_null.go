@@ -14,12 +14,34 @@ func (s *SecurityNull) Type() SecurityMechanismType {
 }
 
 // Handshake performs the ZMTP handshake for this
-// security mechanism
-func (s *SecurityNull) Handshake() error {
-	return nil
-}
+// security mechanism: both ends send their metadata
+// in a READY command. Servers with a ZAP handler ask
+// it whether the client is allowed first.
+func (s *SecurityNull) Handshake(rw CommandReadWriter, asServer bool, peer Greeting, metadata Metadata) (Metadata, Codec, error) {
+	body, err := metadata.Encode()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var reply *ZAPReply
+	if asServer {
+		if reply, err = authenticate(rw, NullSecurityMechanismType); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err := rw.WriteCommand("READY", body); err != nil {
+		return nil, nil, err
+	}
 
-// Encrypt encrypts a []byte
-func (s *SecurityNull) Encrypt(data []byte) []byte {
-	return data
+	command, err := expectCommand(rw, "READY")
+	if err != nil {
+		return nil, nil, err
+	}
+	peerMetadata, err := decodePeerMetadata(command.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	reply.addTo(peerMetadata)
+	return peerMetadata, nil, nil
 }
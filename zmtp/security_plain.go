@@ -0,0 +1,159 @@
+package zmtp
+
+import (
+	"errors"
+	"fmt"
+)
+
+// PlainVerifier verifies the username and password sent by a
+// PLAIN client. A non-nil error rejects the client, its text
+// being sent to the client as the reason of an ERROR command.
+type PlainVerifier func(username, password string) error
+
+// SecurityPlain implements the PlainSecurityMechanismType.
+// Credentials are sent in clear text, so it should only be
+// used over a trusted network or an encrypted transport.
+// See: https://rfc.zeromq.org/spec:24
+type SecurityPlain struct {
+	username string
+	password string
+	verify   PlainVerifier
+}
+
+// NewSecurityPlainClient returns a SecurityPlain mechanism
+// for clients, authenticating with username and password.
+func NewSecurityPlainClient(username, password string) *SecurityPlain {
+	return &SecurityPlain{username: username, password: password}
+}
+
+// NewSecurityPlainServer returns a SecurityPlain mechanism
+// for servers, verifying the credentials of the clients
+// with verify. verify may be nil if the server has a ZAP
+// handler.
+func NewSecurityPlainServer(verify PlainVerifier) *SecurityPlain {
+	return &SecurityPlain{verify: verify}
+}
+
+// Type returns the security mechanisms type
+func (s *SecurityPlain) Type() SecurityMechanismType {
+	return PlainSecurityMechanismType
+}
+
+// Handshake performs the ZMTP handshake for this
+// security mechanism: the client sends its credentials
+// in a HELLO command, which the server answers with a
+// WELCOME or an ERROR command. The client then sends
+// its metadata in an INITIATE command, and the server
+// replies with its own in a READY command.
+//
+// Servers verify the credentials with their verifier and
+// their ZAP handler, at least one of them being needed.
+// The username of the client, or the user id returned by
+// the ZAP handler, is set as the "User-Id" property of its
+// metadata.
+func (s *SecurityPlain) Handshake(rw CommandReadWriter, asServer bool, peer Greeting, metadata Metadata) (Metadata, Codec, error) {
+	body, err := metadata.Encode()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var peerMetadata Metadata
+	if asServer {
+		peerMetadata, err = s.serverHandshake(rw, body)
+	} else {
+		peerMetadata, err = s.clientHandshake(rw, body)
+	}
+	return peerMetadata, nil, err
+}
+
+func (s *SecurityPlain) clientHandshake(rw CommandReadWriter, metadata []byte) (Metadata, error) {
+	if len(s.username) > 255 || len(s.password) > 255 {
+		return nil, errors.New("PLAIN username and password may not be longer than 255 characters")
+	}
+
+	hello := make([]byte, 0, 2+len(s.username)+len(s.password))
+	hello = append(hello, byte(len(s.username)))
+	hello = append(hello, s.username...)
+	hello = append(hello, byte(len(s.password)))
+	hello = append(hello, s.password...)
+	if err := rw.WriteCommand("HELLO", hello); err != nil {
+		return nil, err
+	}
+
+	if _, err := expectCommand(rw, "WELCOME"); err != nil {
+		return nil, err
+	}
+
+	if err := rw.WriteCommand("INITIATE", metadata); err != nil {
+		return nil, err
+	}
+
+	command, err := expectCommand(rw, "READY")
+	if err != nil {
+		return nil, err
+	}
+	return decodePeerMetadata(command.Body)
+}
+
+func (s *SecurityPlain) serverHandshake(rw CommandReadWriter, metadata []byte) (Metadata, error) {
+	command, err := expectCommand(rw, "HELLO")
+	if err != nil {
+		return nil, err
+	}
+
+	username, password, err := parsePlainHello(command.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := authenticate(rw, PlainSecurityMechanismType, []byte(username), []byte(password))
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case s.verify != nil:
+		err = s.verify(username, password)
+	case reply == nil:
+		err = errors.New("no PLAIN verifier")
+	}
+	if err != nil {
+		rw.WriteCommand("ERROR", errorBody(err.Error()))
+		return nil, fmt.Errorf("PLAIN client %q rejected: %v", username, err)
+	}
+
+	if err := rw.WriteCommand("WELCOME", nil); err != nil {
+		return nil, err
+	}
+
+	command, err = expectCommand(rw, "INITIATE")
+	if err != nil {
+		return nil, err
+	}
+	peerMetadata, err := decodePeerMetadata(command.Body)
+	if err != nil {
+		return nil, err
+	}
+	peerMetadata["user-id"] = username
+	reply.addTo(peerMetadata)
+
+	return peerMetadata, rw.WriteCommand("READY", metadata)
+}
+
+// parsePlainHello returns the username and password of
+// the body of a HELLO command.
+func parsePlainHello(body []byte) (string, string, error) {
+	var fields [2]string
+	for i := range fields {
+		if len(body) == 0 || int(body[0]) > len(body)-1 {
+			return "", "", errors.New("Got a malformed HELLO command")
+		}
+		n := int(body[0])
+		fields[i] = string(body[1 : 1+n])
+		body = body[1+n:]
+	}
+	if len(body) != 0 {
+		return "", "", errors.New("Got a malformed HELLO command")
+	}
+	return fields[0], fields[1], nil
+}
@@ -0,0 +1,128 @@
+package zmtp
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+)
+
+// prepareTCP prepares a client and a server connection
+// over the loopback interface, with their own mechanisms.
+func prepareTCP(t *testing.T, client, server SecurityMechanism) (*Connection, *Connection, error) {
+	return prepareTCPWith(t, client, server, nil)
+}
+
+// prepareTCPWithZAP prepares connections as prepareTCP does,
+// the server asking handler to authenticate the client.
+func prepareTCPWithZAP(t *testing.T, client, server SecurityMechanism, handler ZAPHandler) (*Connection, *Connection, error) {
+	return prepareTCPWith(t, client, server, func(clientConn, serverConn *Connection) {
+		serverConn.SetZAPHandler(handler, "test", "127.0.0.1")
+	})
+}
+
+// dialTCP returns both ends of a loopback TCP connection.
+func dialTCP(t *testing.T) (net.Conn, net.Conn) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	a, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a, b
+}
+
+// prepareTCPWith prepares connections as prepareTCP does,
+// once setup was called with them.
+func prepareTCPWith(t *testing.T, client, server SecurityMechanism, setup func(clientConn, serverConn *Connection)) (*Connection, *Connection, error) {
+	a, b := dialTCP(t)
+
+	clientConn, serverConn := NewConnection(a), NewConnection(b)
+	if setup != nil {
+		setup(clientConn, serverConn)
+	}
+
+	errs := make(chan error)
+	go func() {
+		_, err := serverConn.Prepare(server, PullSocketType, SocketIdentity("server"), true, nil)
+		if err != nil {
+			b.Close()
+		}
+		errs <- err
+	}()
+
+	_, err := clientConn.Prepare(client, PushSocketType, SocketIdentity("client"), false, nil)
+	if err != nil {
+		a.Close()
+	}
+	if errB := <-errs; err == nil {
+		err = errB
+	}
+	return clientConn, serverConn, err
+}
+
+func verifyPlain(username, password string) error {
+	if username != "admin" || password != "secret" {
+		return errors.New("invalid username or password")
+	}
+	return nil
+}
+
+func TestSecurityPlain(t *testing.T) {
+	client, server, err := prepareTCP(t,
+		NewSecurityPlainClient("admin", "secret"),
+		NewSecurityPlainServer(verifyPlain),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	defer server.Close()
+
+	if id, _ := server.GetIdentity(); id != "client" {
+		t.Errorf("want identity %q, got %q", "client", id)
+	}
+
+	if userID, _ := server.Metadata("User-Id"); userID != "admin" {
+		t.Errorf("want user id %q, got %q", "admin", userID)
+	}
+
+	err = client.SendFrame([]byte("HELLO"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msgs := make(chan *Message)
+	server.Recv(msgs)
+
+	msg := <-msgs
+	if msg.Err != nil {
+		t.Fatal(msg.Err)
+	}
+
+	if want, got := "HELLO", string(msg.Body[0]); want != got {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+}
+
+func TestSecurityPlainRejected(t *testing.T) {
+	_, _, err := prepareTCP(t,
+		NewSecurityPlainClient("admin", "guess"),
+		NewSecurityPlainServer(verifyPlain),
+	)
+	if err == nil {
+		t.Fatal("want error for invalid credentials")
+	}
+
+	if !strings.Contains(err.Error(), "invalid username or password") {
+		t.Errorf("want the reason sent by the server, got %v", err)
+	}
+}
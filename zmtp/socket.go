@@ -36,6 +36,22 @@ func NewSocket(socketType SocketType) (Socket, error) {
 		return xpubSocket{}, nil
 	case XSubSocketType:
 		return xsubSocket{}, nil
+	case RadioSocketType:
+		return radioSocket{}, nil
+	case DishSocketType:
+		return dishSocket{}, nil
+	case ScatterSocketType:
+		return scatterSocket{}, nil
+	case GatherSocketType:
+		return gatherSocket{}, nil
+	case PairSocketType:
+		return pairSocket{}, nil
+	case PeerSocketType:
+		return peerSocket{}, nil
+	case ChannelSocketType:
+		return channelSocket{}, nil
+	case StreamSocketType:
+		return streamSocket{}, nil
 	default:
 		return nil, errors.New("Invalid socket type")
 	}
@@ -214,8 +230,7 @@ func (pubSocket) IsSocketTypeCompatible(socketType SocketType) bool {
 }
 
 func (pubSocket) IsCommandTypeValid(name string) bool {
-	// FIXME
-	return false
+	return name == "SUBSCRIBE" || name == "CANCEL"
 }
 
 type subSocket struct{}
@@ -252,8 +267,7 @@ func (xpubSocket) IsSocketTypeCompatible(socketType SocketType) bool {
 }
 
 func (xpubSocket) IsCommandTypeValid(name string) bool {
-	// FIXME
-	return false
+	return name == "SUBSCRIBE" || name == "CANCEL"
 }
 
 type xsubSocket struct{}
@@ -274,3 +288,117 @@ func (xsubSocket) IsCommandTypeValid(name string) bool {
 	// FIXME
 	return false
 }
+
+type radioSocket struct{}
+
+func (radioSocket) Type() SocketType {
+	return RadioSocketType
+}
+
+func (radioSocket) IsSocketTypeCompatible(socketType SocketType) bool {
+	return socketType == DishSocketType
+}
+
+func (radioSocket) IsCommandTypeValid(name string) bool {
+	return name == "JOIN" || name == "LEAVE"
+}
+
+type dishSocket struct{}
+
+func (dishSocket) Type() SocketType {
+	return DishSocketType
+}
+
+func (dishSocket) IsSocketTypeCompatible(socketType SocketType) bool {
+	return socketType == RadioSocketType
+}
+
+func (dishSocket) IsCommandTypeValid(name string) bool {
+	return false
+}
+
+type scatterSocket struct{}
+
+func (scatterSocket) Type() SocketType {
+	return ScatterSocketType
+}
+
+func (scatterSocket) IsSocketTypeCompatible(socketType SocketType) bool {
+	return socketType == GatherSocketType
+}
+
+func (scatterSocket) IsCommandTypeValid(name string) bool {
+	return false
+}
+
+type gatherSocket struct{}
+
+func (gatherSocket) Type() SocketType {
+	return GatherSocketType
+}
+
+func (gatherSocket) IsSocketTypeCompatible(socketType SocketType) bool {
+	return socketType == ScatterSocketType
+}
+
+func (gatherSocket) IsCommandTypeValid(name string) bool {
+	return false
+}
+
+type pairSocket struct{}
+
+func (pairSocket) Type() SocketType {
+	return PairSocketType
+}
+
+func (pairSocket) IsSocketTypeCompatible(socketType SocketType) bool {
+	return socketType == PairSocketType
+}
+
+func (pairSocket) IsCommandTypeValid(name string) bool {
+	return false
+}
+
+type peerSocket struct{}
+
+func (peerSocket) Type() SocketType {
+	return PeerSocketType
+}
+
+func (peerSocket) IsSocketTypeCompatible(socketType SocketType) bool {
+	return socketType == PeerSocketType
+}
+
+func (peerSocket) IsCommandTypeValid(name string) bool {
+	return false
+}
+
+type channelSocket struct{}
+
+func (channelSocket) Type() SocketType {
+	return ChannelSocketType
+}
+
+func (channelSocket) IsSocketTypeCompatible(socketType SocketType) bool {
+	return socketType == ChannelSocketType
+}
+
+func (channelSocket) IsCommandTypeValid(name string) bool {
+	return false
+}
+
+type streamSocket struct{}
+
+func (streamSocket) Type() SocketType {
+	return StreamSocketType
+}
+
+// IsSocketTypeCompatible always returns false, as STREAM
+// sockets talk to raw TCP peers instead of ZMTP sockets.
+func (streamSocket) IsSocketTypeCompatible(socketType SocketType) bool {
+	return false
+}
+
+func (streamSocket) IsCommandTypeValid(name string) bool {
+	return false
+}
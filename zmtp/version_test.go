@@ -0,0 +1,233 @@
+package zmtp
+
+import (
+	"fmt"
+	"io"
+	"testing"
+)
+
+// prepareZMTP30 prepares a connection of the given socket type,
+// using NULL, whose other end is a ZMTP 3.0 peer of peerType.
+// The connection to the peer is returned unprepared, to read
+// and write its frames.
+func prepareZMTP30(t *testing.T, socketType, peerType SocketType) (*Connection, *Connection) {
+	a, b := dialTCP(t)
+
+	errs := make(chan error)
+	peer := NewConnection(b)
+	go func() {
+		g := greeting{
+			SignaturePrefix: signaturePrefix,
+			SignatureSuffix: signatureSuffix,
+			Version:         version30,
+			ServerFlag:      toByteBool(true),
+		}
+		toNullPaddedString(string(NullSecurityMechanismType), g.Mechanism[:])
+		if err := g.marshal(b); err != nil {
+			errs <- err
+			return
+		}
+		if err := g.unmarshal(b); err != nil {
+			errs <- err
+			return
+		}
+
+		body, _ := Metadata{"Socket-Type": string(peerType), "Identity": ""}.Encode()
+		if err := peer.SendCommand("READY", body); err != nil {
+			errs <- err
+			return
+		}
+		_, err := expectCommand(handshakeCommands{peer}, "READY")
+		errs <- err
+	}()
+
+	conn := NewConnection(a)
+	if _, err := conn.Prepare(NewSecurityNull(), socketType, nil, false, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+	return conn, peer
+}
+
+func TestZMTP30Subscriber(t *testing.T) {
+	sub, peer := prepareZMTP30(t, SubSocketType, PubSocketType)
+	defer sub.Close()
+	defer peer.Close()
+
+	if want, got := version30, sub.Version(); want != got {
+		t.Fatalf("want version %v, got %v", want, got)
+	}
+
+	for _, tc := range []struct {
+		name string
+		want string
+	}{
+		{"SUBSCRIBE", "\x01topic"},
+		{"CANCEL", "\x00topic"},
+	} {
+		if err := sub.SendCommand(tc.name, []byte("topic")); err != nil {
+			t.Fatal(err)
+		}
+
+		isCommand, body, err := peer.read()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if isCommand {
+			t.Fatalf("want %v to be sent as a message", tc.name)
+		}
+
+		if tc.want != string(body) {
+			t.Fatalf("want %q, got %q", tc.want, body)
+		}
+	}
+}
+
+func TestZMTP30Publisher(t *testing.T) {
+	pub, peer := prepareZMTP30(t, PubSocketType, SubSocketType)
+	defer pub.Close()
+	defer peer.Close()
+
+	msgs := make(chan *Message)
+	pub.RecvMultipart(msgs)
+
+	for _, tc := range []struct {
+		msg  string
+		want string
+	}{
+		{"\x01topic", "SUBSCRIBE"},
+		{"\x00topic", "CANCEL"},
+	} {
+		if err := peer.SendFrame([]byte(tc.msg)); err != nil {
+			t.Fatal(err)
+		}
+
+		msg := <-msgs
+		if msg.Err != nil {
+			t.Fatal(msg.Err)
+		}
+
+		if tc.want != msg.Name {
+			t.Fatalf("want command %q, got %q", tc.want, msg.Name)
+		}
+
+		if want, got := "topic", string(msg.Body[0]); want != got {
+			t.Fatalf("want %q, got %q", want, got)
+		}
+	}
+}
+
+func TestZMTP31(t *testing.T) {
+	client, server, err := prepareTCP(t, NewSecurityNull(), NewSecurityNull())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	defer server.Close()
+
+	if want, got := version, client.Version(); want != got {
+		t.Fatalf("want version %v, got %v", want, got)
+	}
+
+	if want, got := version, server.Version(); want != got {
+		t.Fatalf("want version %v, got %v", want, got)
+	}
+}
+
+// dialZMTP20 returns a connection of the given socket type,
+// unprepared, whose other end is a ZMTP 2.0 peer of peerType
+// with the given identity. The peer checks the greeting it
+// receives, reporting the outcome on the error channel, and
+// then returns the frames it reads.
+func dialZMTP20(t *testing.T, socketType, peerType SocketType, identity string) (*Connection, <-chan []byte, <-chan error) {
+	a, b := dialTCP(t)
+
+	frames := make(chan []byte)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(frames)
+		defer b.Close()
+
+		greeting := []byte{signaturePrefix, 0, 0, 0, 0, 0, 0, 0, 1, signatureSuffix}
+		greeting = append(greeting, zmtp20Revision, zmtp20SocketTypes[peerType], 0, byte(len(identity)))
+		if _, err := b.Write(append(greeting, identity...)); err != nil {
+			errs <- err
+			return
+		}
+
+		var buf [greetingPrefixLength + 3]byte
+		if _, err := io.ReadFull(b, buf[:]); err != nil {
+			errs <- err
+			return
+		}
+		if buf[10] != majorVersion || buf[11] != zmtp20SocketTypes[socketType] || buf[12] != 0 {
+			errs <- fmt.Errorf("want a ZMTP 2.0 greeting of a %v socket, got %v", socketType, buf)
+			return
+		}
+		if _, err := io.ReadFull(b, make([]byte, buf[13])); err != nil {
+			errs <- err
+			return
+		}
+		errs <- nil
+
+		peer := NewConnection(b)
+		for {
+			_, body, err := peer.read()
+			if err != nil {
+				return
+			}
+			frames <- body
+		}
+	}()
+
+	return NewConnection(a), frames, errs
+}
+
+func TestZMTP20(t *testing.T) {
+	conn, frames, errs := dialZMTP20(t, SubSocketType, PubSocketType, "publisher")
+	defer conn.Close()
+
+	conn.SetZMTP20Allowed(true)
+	if _, err := conn.Prepare(NewSecurityNull(), SubSocketType, SocketIdentity("subscriber"), false, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := version20, conn.Version(); want != got {
+		t.Fatalf("want version %v, got %v", want, got)
+	}
+
+	if id, _ := conn.GetIdentity(); id != "publisher" {
+		t.Fatalf("want identity %q, got %q", "publisher", id)
+	}
+
+	if err := conn.SendCommand("SUBSCRIBE", []byte("topic")); err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := "\x01topic", string(<-frames); want != got {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+}
+
+func TestZMTP20NotAllowed(t *testing.T) {
+	conn, _, _ := dialZMTP20(t, SubSocketType, PubSocketType, "")
+	defer conn.Close()
+
+	if _, err := conn.Prepare(NewSecurityNull(), SubSocketType, nil, false, nil); err == nil {
+		t.Fatal("preparing a connection to a ZMTP 2.0 peer MUST raise error unless allowed")
+	}
+
+	conn, _, _ = dialZMTP20(t, SubSocketType, PubSocketType, "")
+	defer conn.Close()
+
+	conn.SetZMTP20Allowed(true)
+	if _, err := conn.Prepare(NewSecurityPlainClient("user", "pass"), SubSocketType, nil, false, nil); err == nil {
+		t.Fatal("preparing a PLAIN connection to a ZMTP 2.0 peer MUST raise error")
+	}
+}
@@ -0,0 +1,63 @@
+package zmtp
+
+import (
+	"fmt"
+)
+
+// z85Alphabet is the alphabet of Z85 encoded strings.
+const z85Alphabet = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ.-:+=^!/*?&<>()[]{}@%$#"
+
+// z85Decoder maps the characters of z85Alphabet to their
+// values, offset by one so that zero marks invalid ones.
+var z85Decoder = func() (decoder [256]byte) {
+	for i := 0; i < len(z85Alphabet); i++ {
+		decoder[z85Alphabet[i]] = byte(i + 1)
+	}
+	return decoder
+}()
+
+// Z85Encode encodes data as a Z85 string. The length of
+// data must be a multiple of 4.
+// See: https://rfc.zeromq.org/spec:32
+func Z85Encode(data []byte) (string, error) {
+	if len(data)%4 != 0 {
+		return "", fmt.Errorf("Z85 data length %v is not a multiple of 4", len(data))
+	}
+
+	buf := make([]byte, 0, len(data)/4*5)
+	for i := 0; i < len(data); i += 4 {
+		value := byteOrder.Uint32(data[i : i+4])
+		var chunk [5]byte
+		for j := 4; j >= 0; j-- {
+			chunk[j] = z85Alphabet[value%85]
+			value /= 85
+		}
+		buf = append(buf, chunk[:]...)
+	}
+	return string(buf), nil
+}
+
+// Z85Decode decodes a Z85 string. The length of s must
+// be a multiple of 5.
+func Z85Decode(s string) ([]byte, error) {
+	if len(s)%5 != 0 {
+		return nil, fmt.Errorf("Z85 string length %v is not a multiple of 5", len(s))
+	}
+
+	data := make([]byte, len(s)/5*4)
+	for i := 0; i < len(s); i += 5 {
+		var value uint64
+		for j := 0; j < 5; j++ {
+			digit := z85Decoder[s[i+j]]
+			if digit == 0 {
+				return nil, fmt.Errorf("Invalid Z85 character %q", s[i+j])
+			}
+			value = value*85 + uint64(digit-1)
+		}
+		if value > 0xffffffff {
+			return nil, fmt.Errorf("Z85 chunk %q overflows 32 bits", s[i:i+5])
+		}
+		byteOrder.PutUint32(data[i/5*4:], uint32(value))
+	}
+	return data, nil
+}
@@ -0,0 +1,42 @@
+package zmtp
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestZ85(t *testing.T) {
+	data := []byte{0x86, 0x4F, 0xD2, 0x6F, 0xB5, 0x59, 0xF7, 0x5B}
+
+	s, err := Z85Encode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := "HelloWorld", s; want != got {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+
+	decoded, err := Z85Decode(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(data, decoded) {
+		t.Fatalf("want %x, got %x", data, decoded)
+	}
+
+	if _, err := Z85Encode(data[:3]); err == nil {
+		t.Error("encoding 3 bytes MUST raise error")
+	}
+
+	for _, s := range []string{
+		"Hell",       // length not a multiple of 5
+		"Hello Worl", // invalid character
+		"%nSc1",      // chunk overflowing 32 bits
+	} {
+		if _, err := Z85Decode(s); err == nil {
+			t.Errorf("decoding %q MUST raise error", s)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package zmtp
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// zapVersion is the version of ZAP requests and replies.
+const zapVersion = "1.0"
+
+// ZAP status codes
+const (
+	ZAPStatusOK            = "200"
+	ZAPStatusTemporary     = "300"
+	ZAPStatusDenied        = "400"
+	ZAPStatusInternalError = "500"
+)
+
+// ZAPRequest is a request sent to a ZAP handler to authenticate
+// a peer. Credentials depend on the mechanism: none for NULL,
+// the username and password for PLAIN, and the long-term public
+// key of the client for CURVE.
+// See: https://rfc.zeromq.org/spec:27
+type ZAPRequest struct {
+	RequestID   string
+	Domain      string
+	Address     string
+	Identity    string
+	Mechanism   SecurityMechanismType
+	Credentials [][]byte
+}
+
+// ZAPReply is the reply of a ZAP handler. A peer is allowed if
+// StatusCode is ZAPStatusOK. UserID and Metadata, if any, are
+// added to the metadata of the connection.
+type ZAPReply struct {
+	RequestID  string
+	StatusCode string
+	StatusText string
+	UserID     string
+	Metadata   Metadata
+}
+
+// ZAPHandler is a ZAP handler, called during the handshake of
+// the connections accepted by a server.
+type ZAPHandler func(req *ZAPRequest) *ZAPReply
+
+// Encode returns the frames of the request.
+func (r *ZAPRequest) Encode() [][]byte {
+	frames := [][]byte{
+		[]byte(zapVersion),
+		[]byte(r.RequestID),
+		[]byte(r.Domain),
+		[]byte(r.Address),
+		[]byte(r.Identity),
+		[]byte(r.Mechanism),
+	}
+	return append(frames, r.Credentials...)
+}
+
+// DecodeZAPRequest decodes the frames of a request.
+func DecodeZAPRequest(frames [][]byte) (*ZAPRequest, error) {
+	if len(frames) < 6 {
+		return nil, errors.New("ZAP request has too few frames")
+	}
+	if string(frames[0]) != zapVersion {
+		return nil, fmt.Errorf("ZAP version %q is not supported", frames[0])
+	}
+	return &ZAPRequest{
+		RequestID:   string(frames[1]),
+		Domain:      string(frames[2]),
+		Address:     string(frames[3]),
+		Identity:    string(frames[4]),
+		Mechanism:   SecurityMechanismType(frames[5]),
+		Credentials: frames[6:],
+	}, nil
+}
+
+// Encode returns the frames of the reply.
+func (r *ZAPReply) Encode() ([][]byte, error) {
+	metadata, err := r.Metadata.Encode()
+	if err != nil {
+		return nil, err
+	}
+	return [][]byte{
+		[]byte(zapVersion),
+		[]byte(r.RequestID),
+		[]byte(r.StatusCode),
+		[]byte(r.StatusText),
+		[]byte(r.UserID),
+		metadata,
+	}, nil
+}
+
+// DecodeZAPReply decodes the frames of a reply.
+func DecodeZAPReply(frames [][]byte) (*ZAPReply, error) {
+	if len(frames) != 6 {
+		return nil, errors.New("ZAP reply must have 6 frames")
+	}
+	if string(frames[0]) != zapVersion {
+		return nil, fmt.Errorf("ZAP version %q is not supported", frames[0])
+	}
+	metadata, err := DecodeMetadata(frames[5])
+	if err != nil {
+		return nil, err
+	}
+	return &ZAPReply{
+		RequestID:  string(frames[1]),
+		StatusCode: string(frames[2]),
+		StatusText: string(frames[3]),
+		UserID:     string(frames[4]),
+		Metadata:   metadata,
+	}, nil
+}
+
+// zapAuthenticator is implemented by the CommandReadWriter
+// of the connections having a ZAP handler.
+type zapAuthenticator interface {
+	authenticate(mechanism SecurityMechanismType, credentials [][]byte) *ZAPReply
+}
+
+// authenticate asks the ZAP handler of the connection, if any,
+// whether the peer is allowed. A denied peer is sent an ERROR
+// command holding the status code, and an error is returned.
+// The reply is nil if there is no ZAP handler.
+func authenticate(rw CommandReadWriter, mechanism SecurityMechanismType, credentials ...[]byte) (*ZAPReply, error) {
+	a, ok := rw.(zapAuthenticator)
+	if !ok {
+		return nil, nil
+	}
+
+	reply := a.authenticate(mechanism, credentials)
+	if reply == nil {
+		reply = &ZAPReply{StatusCode: ZAPStatusInternalError, StatusText: "no ZAP reply"}
+	}
+	if reply.StatusCode != ZAPStatusOK {
+		rw.WriteCommand("ERROR", errorBody(reply.StatusCode))
+		return nil, fmt.Errorf("ZAP handler refused peer: %v %v", reply.StatusCode, reply.StatusText)
+	}
+	return reply, nil
+}
+
+// addTo adds the user id and the metadata of the reply, if
+// any, to the metadata of a peer. Property names are lowercased.
+func (r *ZAPReply) addTo(metadata Metadata) {
+	if r == nil {
+		return
+	}
+	for k, v := range r.Metadata {
+		metadata[strings.ToLower(k)] = v
+	}
+	if r.UserID != "" {
+		metadata["user-id"] = r.UserID
+	}
+}
+
+// zap is the ZAP configuration of a connection.
+type zap struct {
+	handler  ZAPHandler
+	domain   string
+	address  string
+	identity string
+	requests uint64
+}
+
+// SetZAPHandler sets the ZAP handler asked to authenticate the
+// other end during the handshake, when the connection is prepared
+// as a server. domain is the ZAP domain of the server, and address
+// the address of the other end. It must be called before Prepare.
+func (c *Connection) SetZAPHandler(handler ZAPHandler, domain, address string) {
+	c.zap = &zap{handler: handler, domain: domain, address: address}
+}
+
+// zapCommands are the handshake commands of a
+// connection having a ZAP handler
+type zapCommands struct {
+	handshakeCommands
+}
+
+func (h zapCommands) authenticate(mechanism SecurityMechanismType, credentials [][]byte) *ZAPReply {
+	z := h.c.zap
+	z.requests++
+	return z.handler(&ZAPRequest{
+		RequestID:   fmt.Sprint(z.requests),
+		Domain:      z.domain,
+		Address:     z.address,
+		Identity:    z.identity,
+		Mechanism:   mechanism,
+		Credentials: credentials,
+	})
+}
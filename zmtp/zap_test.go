@@ -0,0 +1,111 @@
+package zmtp
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestZAP(t *testing.T) {
+	var req *ZAPRequest
+	handler := func(r *ZAPRequest) *ZAPReply {
+		req = r
+		return &ZAPReply{
+			RequestID:  r.RequestID,
+			StatusCode: ZAPStatusOK,
+			UserID:     "anonymous",
+			Metadata:   Metadata{"Hello": "World"},
+		}
+	}
+
+	client, server, err := prepareTCPWithZAP(t, NewSecurityNull(), NewSecurityNull(), handler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	defer server.Close()
+
+	if req == nil {
+		t.Fatal("want the ZAP handler to be called")
+	}
+
+	for _, tc := range []struct{ want, got string }{
+		{"test", req.Domain},
+		{"127.0.0.1", req.Address},
+		{"server", req.Identity},
+		{"NULL", string(req.Mechanism)},
+	} {
+		if tc.want != tc.got {
+			t.Errorf("want %q, got %q", tc.want, tc.got)
+		}
+	}
+
+	if userID, _ := server.Metadata("User-Id"); userID != "anonymous" {
+		t.Errorf("want user id %q, got %q", "anonymous", userID)
+	}
+
+	if hello, _ := server.Metadata("Hello"); hello != "World" {
+		t.Errorf("want metadata %q, got %q", "World", hello)
+	}
+}
+
+func TestZAPDenied(t *testing.T) {
+	handler := func(r *ZAPRequest) *ZAPReply {
+		if r.Mechanism != PlainSecurityMechanismType || len(r.Credentials) != 2 {
+			t.Errorf("want PLAIN credentials, got %v %q", r.Mechanism, r.Credentials)
+		}
+		return &ZAPReply{RequestID: r.RequestID, StatusCode: ZAPStatusDenied}
+	}
+
+	_, _, err := prepareTCPWithZAP(t,
+		NewSecurityPlainClient("admin", "secret"),
+		NewSecurityPlainServer(nil),
+		handler,
+	)
+	if err == nil {
+		t.Fatal("want error for a denied client")
+	}
+
+	if !strings.Contains(err.Error(), ZAPStatusDenied) {
+		t.Errorf("want the status code sent by the server, got %v", err)
+	}
+}
+
+func TestZAPFrames(t *testing.T) {
+	req := &ZAPRequest{
+		RequestID:   "1",
+		Domain:      "global",
+		Address:     "127.0.0.1",
+		Mechanism:   PlainSecurityMechanismType,
+		Credentials: [][]byte{[]byte("admin"), []byte("secret")},
+	}
+
+	decoded, err := DecodeZAPRequest(req.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := "secret", string(decoded.Credentials[1]); want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	reply := &ZAPReply{RequestID: "1", StatusCode: ZAPStatusOK, UserID: "admin"}
+	frames, err := reply.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decodedReply, err := DecodeZAPReply(frames)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := "admin", decodedReply.UserID; want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	metadata := make(Metadata)
+	(&ZAPReply{UserID: "admin", Metadata: Metadata{"Hello": "World"}}).addTo(metadata)
+	if want, got := "World", metadata["hello"]; want != got {
+		t.Errorf("want metadata %q, got %q", want, got)
+	}
+}
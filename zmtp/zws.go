@@ -0,0 +1,61 @@
+package zmtp
+
+import "errors"
+
+// MessageReadWriter is implemented by message-oriented transports,
+// such as WebSocket, that carry ZMTP frames in messages of their own.
+// As there is no greeting, Mechanism returns the security mechanism
+// agreed on with the other end by the transport, e.g. through the
+// WebSocket subprotocol.
+type MessageReadWriter interface {
+	ReadMessage() ([]byte, error)
+	WriteMessage([]byte) error
+	Mechanism() (SecurityMechanismType, error)
+}
+
+const (
+	zwsHasMoreBitFlag   = 0x1
+	zwsIsCommandBitFlag = 0x2
+)
+
+// NewMessageConnection accepts a MessageReadWriter and creates a new ZMTP
+// connection over it, following the ZWS/2.0 mapping: there is no greeting,
+// and each frame is sent in a message of its own, made of a flags octet
+// followed by the frame body.
+// See: https://rfc.zeromq.org/spec:45
+func NewMessageConnection(mrw MessageReadWriter) *Connection {
+	c := NewConnection(nil)
+	c.messages = mrw
+	return c
+}
+
+// writeMessageFrame sends a single frame as a message
+func (c *Connection) writeMessageFrame(isCommand, hasMore bool, body []byte) error {
+	var bitFlags byte
+	if hasMore {
+		bitFlags ^= zwsHasMoreBitFlag
+	}
+	if isCommand {
+		bitFlags ^= zwsIsCommandBitFlag
+	}
+
+	buf := make([]byte, 1+len(body))
+	buf[0] = bitFlags
+	copy(buf[1:], body)
+	return c.messages.WriteMessage(buf)
+}
+
+// readMessageFrame reads a single frame, sent as a message
+func (c *Connection) readMessageFrame() (bool, bool, []byte, error) {
+	buf, err := c.messages.ReadMessage()
+	if err != nil {
+		return false, false, nil, err
+	}
+	if len(buf) == 0 {
+		return false, false, nil, errors.New("Received a message without flags")
+	}
+
+	hasMore := buf[0]&zwsHasMoreBitFlag == zwsHasMoreBitFlag
+	isCommand := buf[0]&zwsIsCommandBitFlag == zwsIsCommandBitFlag
+	return isCommand, hasMore, buf[1:], nil
+}